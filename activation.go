@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor systemd passes to an activated
+// service.
+const listenFdsStart = 3
+
+// activatedListener is a socket passed in by systemd socket activation.
+type activatedListener struct {
+	// name is the socket's FileDescriptorName, "api" when it has none.
+	name string
+	ln   net.Listener
+}
+
+// activationListeners returns the sockets passed in by systemd socket
+// activation in the order systemd passed them, or nil when the process was
+// not socket activated. Several sockets may have the same name, like the
+// unnamed ones, which are all "api", except "admin".
+func activationListeners() ([]activatedListener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds == 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Don't leak the activation environment into child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	files := make([]*os.File, nfds)
+	for i := range files {
+		files[i] = os.NewFile(uintptr(listenFdsStart+i), "LISTEN_FD_"+strconv.Itoa(listenFdsStart+i))
+	}
+	return fileListeners(files, names)
+}
+
+// fileListeners turns the activated sockets files, named by names, into
+// listeners, closing the files.
+func fileListeners(files []*os.File, names []string) ([]activatedListener, error) {
+	listeners := make([]activatedListener, 0, len(files))
+	for i, f := range files {
+		name := "api"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err == nil && name == "admin" && adminListener(listeners) != nil {
+			ln.Close()
+			err = errors.New(`more than one socket is named "admin"`)
+		}
+		if err != nil {
+			for _, l := range listeners {
+				l.ln.Close()
+			}
+			return nil, fmt.Errorf("activated socket %s: %w", f.Name(), err)
+		}
+		listeners = append(listeners, activatedListener{name: name, ln: ln})
+	}
+	return listeners, nil
+}
+
+// adminListener returns the activated socket named "admin", if any.
+func adminListener(listeners []activatedListener) net.Listener {
+	for _, l := range listeners {
+		if l.name == "admin" {
+			return l.ln
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+)
+
+// listenerFile returns the file of a new loopback TCP listener.
+func listenerFile(t *testing.T) *os.File {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get the listener's file: %v", err)
+	}
+	return f
+}
+
+func TestFileListeners(t *testing.T) {
+	// Two unnamed sockets are both served as "api".
+	listeners, err := fileListeners([]*os.File{listenerFile(t), listenerFile(t), listenerFile(t)}, []string{"", "", "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.ln.Close()
+		}
+	}()
+	if assert.Len(t, listeners, 3) {
+		assert.Equal(t, "api", listeners[0].name)
+		assert.Equal(t, "api", listeners[1].name)
+		assert.NotEqual(t, listeners[0].ln.Addr(), listeners[1].ln.Addr())
+		assert.Equal(t, listeners[2].ln, adminListener(listeners))
+	}
+
+	_, err = fileListeners([]*os.File{listenerFile(t), listenerFile(t)}, []string{"admin", "admin"})
+	assert.ErrorContains(t, err, `more than one socket is named "admin"`)
+}
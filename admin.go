@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+)
+
+//go:embed admin
+var adminAssets embed.FS
+
+// registerAdmin mounts the embedded dashboard, the backup, tenant and
+// archiver endpoints under /admin. They are only served when ADMIN_PASSWORD
+// is configured so they are never exposed without credentials.
+func (g *GoPOS) registerAdmin(router gin.IRouter) {
+	viper.SetDefault("ADMIN_USER", "admin")
+	if viper.GetString("ADMIN_PASSWORD") == "" {
+		log.Println("ADMIN_PASSWORD not set, admin dashboard disabled")
+		return
+	}
+
+	assets, err := fs.Sub(adminAssets, "admin")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	admin := router.Group("/admin", g.middleware("dashboard")...)
+	// A catch-all StaticFS would conflict with the endpoints below, so each
+	// asset gets its own route.
+	files := http.FS(assets)
+	err = fs.WalkDir(assets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		route := "/" + path
+		if path == "index.html" {
+			route = "/"
+		}
+		serve := func(c *gin.Context) {
+			c.FileFromFS(route, files)
+		}
+		admin.GET(route, serve)
+		admin.HEAD(route, serve)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	admin.POST("/backup", g.backup)
+	admin.POST("/restore", g.restore)
+	admin.GET("/tenants", g.getTenants)
+	admin.POST("/tenants", g.createTenant)
+	admin.GET("/archive-runs", g.getArchiveRuns)
+}
+
+// statementTimeout lets an admin request set a shorter limit for its queries
+// in the X-Statement-Timeout header, e.g. "2s". The request's context is
+// cancelled when it runs out, which cancels the running query on the server.
+// DB_STATEMENT_TIMEOUT still applies, so the header cannot raise the limit.
+func statementTimeout(c *gin.Context) {
+	header := c.GetHeader("X-Statement-Timeout")
+	if header == "" {
+		c.Next()
+		return
+	}
+	timeout, err := time.ParseDuration(header)
+	if err != nil || timeout <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid X-Statement-Timeout"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
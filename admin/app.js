@@ -0,0 +1,32 @@
+async function loadHealth() {
+    const el = document.getElementById("health");
+    try {
+        const resp = await fetch("/health");
+        const body = await resp.json();
+        el.textContent = body.status;
+        el.className = "health " + (resp.ok ? "ok" : "down");
+    } catch (e) {
+        el.textContent = "unreachable";
+        el.className = "health down";
+    }
+}
+
+async function loadItems() {
+    const resp = await fetch("/items");
+    const items = await resp.json();
+    const tbody = document.getElementById("items");
+    tbody.replaceChildren();
+    for (const item of items) {
+        const row = document.createElement("tr");
+        for (const value of [item.id, item.name, item.price]) {
+            const cell = document.createElement("td");
+            cell.textContent = value;
+            row.appendChild(cell);
+        }
+        tbody.appendChild(row);
+    }
+}
+
+loadHealth();
+loadItems();
+setInterval(loadHealth, 10000);
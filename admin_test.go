@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestAdminListener serves the routers as with GOPOS_ADMIN_ADDR set: the
+// dashboard on the admin listener lists the items from its own origin.
+func TestAdminListener(t *testing.T) {
+	viper.Set("ADMIN_PASSWORD", "secret")
+	t.Cleanup(func() { viper.Set("ADMIN_PASSWORD", "") })
+
+	g := &GoPOS{store: newMemItemStore()}
+	api, admin := g.newRouters(prometheus.NewRegistry(), true)
+	if !assert.NotNil(t, admin) {
+		return
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"TestAdminListener","price":1}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	for _, path := range []string{"/admin/app.js", "/admin/tenants"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.SetBasicAuth("admin", "secret")
+		w = httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+	req.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "app.js")
+
+	for _, path := range []string{"/items", "/items/1", "/health"} {
+		w = httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	// The admin listener only reads items, and the API has no dashboard.
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"x","price":1}`)))
+	assert.NotEqual(t, http.StatusCreated, w.Code)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSharedAdminListener(t *testing.T) {
+	viper.Set("ADMIN_PASSWORD", "secret")
+	t.Cleanup(func() { viper.Set("ADMIN_PASSWORD", "") })
+
+	g := &GoPOS{store: newMemItemStore()}
+	api, admin := g.newRouters(prometheus.NewRegistry(), false)
+	assert.Nil(t, admin)
+	req := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+	req.SetBasicAuth("admin", "secret")
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
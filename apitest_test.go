@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// client is bound to the API under test by TestMain.
+var client *apiClient
+
+// apiClient talks to the items API under test. Every call asserts the
+// response status and fails the test on mismatch, so tests only spell out
+// what they are checking.
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL string) *apiClient {
+	return &apiClient{
+		baseURL: baseURL,
+		http:    http.DefaultClient,
+	}
+}
+
+func (c *apiClient) CreateItem(t testing.TB, item Item) Item {
+	t.Helper()
+	var created Item
+	c.Request(t, http.MethodPost, "/items", item, http.StatusCreated, &created)
+	return created
+}
+
+func (c *apiClient) GetItem(t testing.TB, id int) Item {
+	t.Helper()
+	var item Item
+	c.Request(t, http.MethodGet, fmt.Sprintf("/items/%d", id), nil, http.StatusOK, &item)
+	return item
+}
+
+func (c *apiClient) GetItems(t testing.TB) []Item {
+	t.Helper()
+	var items []Item
+	c.Request(t, http.MethodGet, "/items", nil, http.StatusOK, &items)
+	return items
+}
+
+func (c *apiClient) UpdateItem(t testing.TB, id int, item Item) Item {
+	t.Helper()
+	var updated Item
+	c.Request(t, http.MethodPut, fmt.Sprintf("/items/%d", id), item, http.StatusOK, &updated)
+	return updated
+}
+
+func (c *apiClient) DeleteItem(t testing.TB, id int) {
+	t.Helper()
+	c.Request(t, http.MethodDelete, fmt.Sprintf("/items/%d", id), nil, http.StatusNoContent, nil)
+}
+
+// Request sends body as JSON to path, asserts the response has wantStatus and
+// decodes the response body into out unless it is nil.
+func (c *apiClient) Request(t testing.TB, method string, path string, body any, wantStatus int, out any) {
+	t.Helper()
+
+	status, respBody := c.Do(t, method, path, body)
+	if status != wantStatus {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, wantStatus, status, respBody)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			t.Fatalf("Failed to decode response %q: %v", respBody, err)
+		}
+	}
+}
+
+// Do sends body as JSON to path and returns the response status and body
+// without asserting anything about them.
+func (c *apiClient) Do(t testing.TB, method string, path string, body any) (int, []byte) {
+	t.Helper()
+	trackTest(t)
+
+	status, respBody, err := c.Send(method, path, body)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return status, respBody
+}
+
+// Send is Do returning its errors instead of failing the test, for requests
+// sent outside the test goroutine.
+func (c *apiClient) Send(method string, path string, body any) (int, []byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		jsonValue, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("encode request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonValue)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, fmt.Errorf("build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp.StatusCode, respBody, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+	"log"
+	"net/http"
+	"time"
+)
+
+// archiveTable moves the rows of table older than a cutoff into its
+// archive table. query moves one batch: $1 is the cutoff, $2 the batch
+// size and $3 the time of archiving.
+type archiveTable struct {
+	table string
+	query string
+}
+
+// archiveTables are archived in order. Items are soft-deleted, see
+// deleteItemQuery; moving them out takes their tags and reservations with
+// them.
+var archiveTables = []archiveTable{
+	{table: "items", query: `WITH batch AS (
+		SELECT id FROM items WHERE deleted_at < $1 ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED
+	), moved AS (
+		DELETE FROM items WHERE id IN (SELECT id FROM batch) RETURNING id, name, price, stock, deleted_at
+	)
+	INSERT INTO items_archive (id, name, price, stock, deleted_at, archived_at)
+	SELECT id, name, price, stock, deleted_at, $3::timestamptz FROM moved`},
+}
+
+// ArchiveRun is the progress of archiving one table, updated after every
+// batch. FinishedAt stays nil while it runs, or when it failed.
+type ArchiveRun struct {
+	ID         int        `json:"id"`
+	Table      string     `json:"table"`
+	Cutoff     time.Time  `json:"cutoff"`
+	Archived   int64      `json:"archived"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// archive moves what is older than retention at now out of every table in
+// archiveTables, batchSize rows per transaction, so the hot tables stay
+// small without locking them for long.
+func archive(ctx context.Context, db *sql.DB, now time.Time, retention time.Duration, batchSize int) error {
+	cutoff := now.Add(-retention)
+	for _, t := range archiveTables {
+		if err := t.archive(ctx, db, cutoff, now, batchSize); err != nil {
+			return fmt.Errorf("could not archive %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+func (t archiveTable) archive(ctx context.Context, db *sql.DB, cutoff, now time.Time, batchSize int) error {
+	var run int
+	err := db.QueryRowContext(ctx, "INSERT INTO archive_runs (table_name, cutoff, started_at) VALUES ($1, $2, $3) RETURNING id",
+		t.table, cutoff, now).Scan(&run)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, t.query, cutoff, batchSize, now)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		if _, err := db.ExecContext(ctx, "UPDATE archive_runs SET archived = $1 WHERE id = $2", total, run); err != nil {
+			return err
+		}
+		log.Printf("Archived %d rows of %s", total, t.table)
+	}
+	_, err = db.ExecContext(ctx, "UPDATE archive_runs SET archived = $1, finished_at = now() WHERE id = $2", total, run)
+	return err
+}
+
+// archivePeriodically archives every interval until ctx is done. An
+// interval of zero or less disables the archiver.
+func archivePeriodically(ctx context.Context, db *sql.DB, clock Clock, interval, retention time.Duration, batchSize int) {
+	if interval <= 0 {
+		log.Println("Archiver disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := archive(ctx, db, clock.Now(), retention, batchSize); err != nil && ctx.Err() == nil {
+				log.Print(err)
+			}
+		}
+	}
+}
+
+func listArchiveRuns(ctx context.Context, db *sql.DB, limit int) ([]ArchiveRun, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, table_name, cutoff, archived, started_at, finished_at
+		FROM archive_runs ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ArchiveRun{}
+	for rows.Next() {
+		var r ArchiveRun
+		if err := rows.Scan(&r.ID, &r.Table, &r.Cutoff, &r.Archived, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// getArchiveRuns lists the latest archiver runs, newest first.
+func (g *GoPOS) getArchiveRuns(c *gin.Context) {
+	if g.db == nil {
+		c.JSON(http.StatusOK, []ArchiveRun{})
+		return
+	}
+	runs, err := listArchiveRuns(c.Request.Context(), g.db, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+func dbArchive(cmd *cobra.Command, args []string) error {
+	retention, _ := cmd.Flags().GetDuration("retention")
+	batchSize, _ := cmd.Flags().GetInt("batch")
+	if err := postgresOnly("db archive"); err != nil {
+		return err
+	}
+	if retention < 0 || batchSize < 1 {
+		return fmt.Errorf("invalid retention %s or batch size %d", retention, batchSize)
+	}
+
+	dsn, err := dbDSN()
+	if err != nil {
+		return err
+	}
+	db, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return archive(cmd.Context(), db, time.Now(), retention, batchSize)
+}
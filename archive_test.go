@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	db, _ := requireIsolatedDB(t)
+	store := newSQLItemStore(db)
+	ctx := context.Background()
+	item, err := store.CreateItem(ctx, Item{Name: "TestSoftDelete", Price: 1, Stock: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.TagItem(ctx, item.ID, "sale"))
+	assert.NoError(t, store.DeleteItem(ctx, item.ID))
+
+	// Gone for the app, but kept until it is archived.
+	assert.ErrorIs(t, store.DeleteItem(ctx, item.ID), errItemNotFound)
+	_, err = store.GetItem(ctx, item.ID)
+	assert.ErrorIs(t, err, errItemNotFound)
+	_, err = store.UpdateItem(ctx, item.ID, item)
+	assert.ErrorIs(t, err, errItemNotFound)
+	_, err = store.ReserveItem(ctx, item.ID, 1, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, errItemNotFound)
+	assert.ErrorIs(t, store.TagItem(ctx, item.ID, "organic"), errItemNotFound)
+	items, err := store.ListItems(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+	items, err = store.GetItems(ctx, []int{item.ID})
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+	assert.NoError(t, store.EachTaggedItem(ctx, []string{"sale"}, func(Item) error {
+		t.Error("Listed a deleted item")
+		return nil
+	}))
+	AssertRowCount(t, db, "items", 1)
+}
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	db, _ := requireIsolatedDB(t)
+	store := newSQLItemStore(db)
+	ctx := context.Background()
+	now := time.Now()
+	var old []Item
+	for i := 0; i < 3; i++ {
+		item, err := store.CreateItem(ctx, Item{Name: "TestArchive", Price: 1, Stock: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, store.DeleteItem(ctx, item.ID))
+		old = append(old, item)
+	}
+	if _, err := db.Exec("UPDATE items SET deleted_at = $1", now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	recent, err := store.CreateItem(ctx, Item{Name: "TestArchive", Price: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.DeleteItem(ctx, recent.ID))
+	live, err := store.CreateItem(ctx, Item{Name: "TestArchive", Price: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two batches, and an empty one to tell it is done.
+	assert.NoError(t, archive(ctx, db, now, 24*time.Hour, 2))
+	AssertRowCount(t, db, "items_archive", 3)
+	for _, item := range old {
+		AssertRowExists(t, db, "items_archive", map[string]any{"id": item.ID, "name": item.Name, "stock": item.Stock})
+	}
+	AssertRowCount(t, db, "items", 2)
+	AssertRowExists(t, db, "items", map[string]any{"id": recent.ID})
+	_, err = store.GetItem(ctx, live.ID)
+	assert.NoError(t, err)
+
+	runs, err := listArchiveRuns(ctx, db, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, "items", runs[0].Table)
+		assert.EqualValues(t, 3, runs[0].Archived)
+		assert.WithinDuration(t, now.Add(-24*time.Hour), runs[0].Cutoff, time.Millisecond)
+		assert.NotNil(t, runs[0].FinishedAt)
+	}
+
+	// Nothing left to archive until the recent one is old enough.
+	assert.NoError(t, archive(ctx, db, now, 24*time.Hour, 2))
+	AssertRowCount(t, db, "items_archive", 3)
+	assert.NoError(t, archive(ctx, db, now.Add(25*time.Hour), 24*time.Hour, 2))
+	AssertRowCount(t, db, "items_archive", 4)
+}
+
+func TestArchiveDisabled(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		archivePeriodically(context.Background(), nil, systemClock{}, 0, time.Hour, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Disabled archiver did not return")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"os"
+	"path/filepath"
+)
+
+// CaptureArtifacts writes the logs and docker inspect output of every
+// container plus a pg_dump of the database into dir, for debugging failures
+// that only happen in CI. It captures as much as it can and returns the
+// errors it ran into.
+func (l LocalTestContainer) CaptureArtifacts(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	containers := map[string]*dockertest.Resource{
+		"app":     l.appcontainer,
+		"db":      l.dbcontainer,
+		"migrate": l.dbmigratecontainer,
+	}
+	var errs []error
+	for name, resource := range containers {
+		if resource == nil {
+			continue
+		}
+		if err := l.writeLogs(filepath.Join(dir, name+".log"), resource); err != nil {
+			errs = append(errs, fmt.Errorf("%s logs: %w", name, err))
+		}
+		if err := l.writeInspect(filepath.Join(dir, name+"-inspect.json"), resource); err != nil {
+			errs = append(errs, fmt.Errorf("%s inspect: %w", name, err))
+		}
+	}
+	if err := l.writeDump(filepath.Join(dir, "dump.sql")); err != nil {
+		errs = append(errs, fmt.Errorf("pg_dump: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (l LocalTestContainer) writeLogs(path string, resource *dockertest.Resource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return l.pool.Client.Logs(docker.LogsOptions{
+		Container:    resource.Container.ID,
+		OutputStream: f,
+		ErrorStream:  f,
+		Stdout:       true,
+		Stderr:       true,
+		Timestamps:   true,
+	})
+}
+
+func (l LocalTestContainer) writeInspect(path string, resource *dockertest.Resource) error {
+	container, err := l.pool.Client.InspectContainer(resource.Container.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(container, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (l LocalTestContainer) writeDump(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dsn := l.dbHostDSN
+	cmd := []string{"pg_dump", "-U", dsn.User, dsn.DBName}
+	if config := l.dbHostMySQL; config != nil {
+		cmd = []string{"mysqldump", "--no-tablespaces", "-u", config.User, "-p" + config.Passwd, config.DBName}
+	}
+	exitCode, err := l.dbcontainer.Exec(cmd, dockertest.ExecOptions{
+		StdOut: f,
+		StdErr: f,
+	})
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("exited with code %d", exitCode)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupTables are the tables a backup holds, parents first so a restore
+// never breaks a foreign key.
+var backupTables = []string{
+	"tenants", "items", "tags", "item_tags", "reservations", "processed_events",
+	"webhooks", "webhook_deliveries", "webhook_dead_letters", "items_archive", "archive_runs",
+}
+
+// backupHeader starts every backup, followed by the schema version line.
+const backupHeader = "gopos-backup 1"
+
+var errRestoreNotConfirmed = errors.New("restore not confirmed: confirm must be the database name")
+
+// Backup writes every table in backupTables to w, as seen by one snapshot.
+// The format is a header, then per table a "table <name>" line, its rows as
+// COPY text and a "\." line. The app image has no pg_dump matching the
+// server's version, and the tables are all the app needs.
+func (s *sqlItemStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.withConn(ctx, func(conn *pgx.Conn) error {
+		tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		var version uint
+		if err := tx.QueryRow(ctx, "SELECT version FROM schema_migrations").Scan(&version); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\nschema_version %d\n", backupHeader, version); err != nil {
+			return err
+		}
+		for _, table := range backupTables {
+			if _, err := fmt.Fprintf(w, "table %s\n", table); err != nil {
+				return err
+			}
+			if _, err := conn.PgConn().CopyTo(ctx, w, "COPY "+table+" TO STDOUT"); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, "\\.\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore replaces the contents of the backupTables with a backup written by
+// Backup, in one transaction. confirm must be the name of the database, so
+// a backup is never restored into the wrong one by accident, and the backup
+// must come from the same schema version.
+func (s *sqlItemStore) Restore(ctx context.Context, r io.Reader, confirm string) error {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if header != backupHeader+"\n" {
+		return errors.New("not a gopos backup")
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	version, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "schema_version ")), 10, 32)
+	if err != nil {
+		return errors.New("backup has no schema version")
+	}
+
+	return s.withConn(ctx, func(conn *pgx.Conn) error {
+		var database string
+		var current uint64
+		err := conn.QueryRow(ctx, "SELECT current_database(), (SELECT version FROM schema_migrations)").Scan(&database, &current)
+		if err != nil {
+			return err
+		}
+		if confirm != database {
+			return errRestoreNotConfirmed
+		}
+		if current != version {
+			return fmt.Errorf("backup is of schema version %d, the database is at %d", version, current)
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if _, err := tx.Exec(ctx, "TRUNCATE "+strings.Join(backupTables, ", ")); err != nil {
+			return err
+		}
+		for {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line == "" {
+				break
+			}
+			if err == io.EOF {
+				return fmt.Errorf("backup truncated at %q", line)
+			}
+			if err != nil {
+				return err
+			}
+			table := strings.TrimSpace(strings.TrimPrefix(line, "table "))
+			if !strings.HasPrefix(line, "table ") || !isBackupTable(table) {
+				return fmt.Errorf("unexpected line in backup: %q", line)
+			}
+			if _, err := conn.PgConn().CopyFrom(ctx, &copySection{r: br}, "COPY "+table+" FROM STDIN"); err != nil {
+				return fmt.Errorf("restoring %s: %w", table, err)
+			}
+		}
+		// The sequences must continue after the restored ids.
+		for _, table := range []string{"items", "tags", "reservations", "webhooks", "webhook_deliveries", "archive_runs"} {
+			_, err := tx.Exec(ctx, fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), coalesce(max(id), 0) + 1, false) FROM %[1]s", table))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+func isBackupTable(name string) bool {
+	for _, table := range backupTables {
+		if table == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copySection reads the rows of one table of a backup, up to its "\." line.
+// COPY text escapes backslashes, so no row can look like the terminator.
+type copySection struct {
+	r    *bufio.Reader
+	buf  []byte
+	done bool
+}
+
+func (s *copySection) Read(p []byte) (int, error) {
+	if len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		line, err := s.r.ReadBytes('\n')
+		if bytes.Equal(line, []byte("\\.\n")) {
+			s.done = true
+			return 0, io.EOF
+		}
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.buf = line
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// backup streams a backup of the database as the response.
+func (g *GoPOS) backup(c *gin.Context) {
+	if g.db == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Backups need a database"})
+		return
+	}
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="gopos-%s.backup"`, time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+	if err := newSQLItemStore(g.db).Backup(c.Request.Context(), c.Writer); err != nil {
+		// The status is already sent; the truncated backup fails to restore.
+		log.Printf("Backup failed: %s", err)
+		c.Abort()
+	}
+}
+
+// restore replaces the data with the backup in the request body. It is
+// disabled unless GOPOS_ALLOW_RESTORE is set, and the request must name the
+// database in ?confirm=.
+func (g *GoPOS) restore(c *gin.Context) {
+	if !viper.GetBool("GOPOS_ALLOW_RESTORE") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Restore is disabled, set GOPOS_ALLOW_RESTORE to enable it"})
+		return
+	}
+	if g.db == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Restores need a database"})
+		return
+	}
+	err := newSQLItemStore(g.db).Restore(c.Request.Context(), c.Request.Body, c.Query("confirm"))
+	if errors.Is(err, errRestoreNotConfirmed) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
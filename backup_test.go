@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestBackupRestore wipes the database between backup and restore, so it
+// must not run in parallel with other tests.
+func TestBackupRestore(t *testing.T) {
+	db := requireTestDB(t)
+	store := newSQLItemStore(db)
+	ctx := context.Background()
+
+	item, err := store.CreateItem(ctx, Item{Name: "TestBackupRestore", Price: 1, Stock: 3})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(ctx, item.ID)
+	})
+	assert.NoError(t, store.TagItem(ctx, item.ID, "backup"))
+	if _, err := db.Exec("INSERT INTO tenants (name, database) VALUES ('testbackuprestore', 'tenant_testbackuprestore')"); err != nil {
+		t.Fatalf("Failed to register tenant: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM tenants WHERE name = 'testbackuprestore'")
+	})
+	hook, err := createWebhook(ctx, db, "http://example.com/TestBackupRestore")
+	if err != nil {
+		t.Fatalf("Failed to register webhook: %v", err)
+	}
+	t.Cleanup(func() {
+		deleteWebhook(ctx, db, hook.ID)
+	})
+	// Not due for a day, so the app doesn't try to deliver it meanwhile.
+	var deliveryID int
+	err = db.QueryRow(`INSERT INTO webhook_deliveries (webhook_id, payload, next_attempt_at)
+		VALUES ($1, '{"type": "created"}', now() + interval '1 day') RETURNING id`, hook.ID).Scan(&deliveryID)
+	if err != nil {
+		t.Fatalf("Failed to queue delivery: %v", err)
+	}
+	var runID int
+	err = db.QueryRow("INSERT INTO archive_runs (table_name, cutoff, started_at) VALUES ('items', now(), now()) RETURNING id").Scan(&runID)
+	if err != nil {
+		t.Fatalf("Failed to record archive run: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM archive_runs WHERE id = $1", runID)
+	})
+	before := tableCounts(t, db)
+
+	var backup bytes.Buffer
+	if err := store.Backup(ctx, &backup); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	var database string
+	assert.NoError(t, db.QueryRow("SELECT current_database()").Scan(&database))
+	err = store.Restore(ctx, bytes.NewReader(backup.Bytes()), "wrong")
+	assert.ErrorIs(t, err, errRestoreNotConfirmed)
+
+	if _, err := db.Exec("TRUNCATE " + strings.Join(backupTables, ", ")); err != nil {
+		t.Fatalf("Failed to wipe database: %v", err)
+	}
+	if err := store.Restore(ctx, bytes.NewReader(backup.Bytes()), database); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	assert.Equal(t, before, tableCounts(t, db))
+	restored, err := store.GetItem(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, item, restored)
+	AssertRowExists(t, db, "tenants", map[string]any{"name": "testbackuprestore", "database": "tenant_testbackuprestore"})
+	AssertRowExists(t, db, "webhooks", map[string]any{"id": hook.ID, "url": hook.URL})
+	AssertRowExists(t, db, "webhook_deliveries", map[string]any{"id": deliveryID, "webhook_id": hook.ID})
+	created, err := store.CreateItem(ctx, Item{Name: "TestBackupRestore after", Price: 1})
+	assert.NoError(t, err)
+	assert.Greater(t, created.ID, item.ID)
+	store.DeleteItem(ctx, created.ID)
+	AssertRowExists(t, db, "archive_runs", map[string]any{"id": runID, "table_name": "items"})
+	var nextRun int
+	assert.NoError(t, db.QueryRow("INSERT INTO archive_runs (table_name, cutoff, started_at) VALUES ('items', now(), now()) RETURNING id").Scan(&nextRun))
+	assert.Greater(t, nextRun, runID)
+	db.Exec("DELETE FROM archive_runs WHERE id = $1", nextRun)
+	newHook, err := createWebhook(ctx, db, "http://example.com/TestBackupRestore/after")
+	assert.NoError(t, err)
+	assert.Greater(t, newHook.ID, hook.ID)
+	deleteWebhook(ctx, db, newHook.ID)
+
+	// A truncated backup restores nothing.
+	truncated := backup.Bytes()[:backup.Len()-3]
+	assert.Error(t, store.Restore(ctx, bytes.NewReader(truncated), database))
+	assert.Equal(t, before, tableCounts(t, db))
+	// So does one cut within a table line.
+	truncated = append(bytes.Clone(backup.Bytes()), "table ite"...)
+	assert.ErrorContains(t, store.Restore(ctx, bytes.NewReader(truncated), database), `backup truncated at "table ite"`)
+	assert.Equal(t, before, tableCounts(t, db))
+}
+
+func TestRestoreReadError(t *testing.T) {
+	store := newSQLItemStore(nil)
+	errRead := errors.New("connection reset")
+	err := store.Restore(context.Background(), iotest.ErrReader(errRead), "db")
+	assert.ErrorIs(t, err, errRead)
+	err = store.Restore(context.Background(), io.MultiReader(strings.NewReader(backupHeader+"\n"), iotest.ErrReader(errRead)), "db")
+	assert.ErrorIs(t, err, errRead)
+	err = store.Restore(context.Background(), strings.NewReader("gopos-backup"), "db")
+	assert.EqualError(t, err, "not a gopos backup")
+}
+
+func tableCounts(t *testing.T, db *sql.DB) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, table := range backupTables {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		counts[table] = n
+	}
+	return counts
+}
+
+func TestCopySection(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("1\tback\\\\.\n\\.\ntable tags\n"))
+
+	rows, err := io.ReadAll(&copySection{r: r})
+	assert.NoError(t, err)
+	assert.Equal(t, "1\tback\\\\.\n", string(rows))
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "table tags\n", string(rest))
+
+	_, err = io.ReadAll(&copySection{r: bufio.NewReader(strings.NewReader("1\tcut"))})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRestoreDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := &GoPOS{store: newMemItemStore()}
+	router := gin.New()
+	router.POST("/admin/restore", g.restore)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/restore", strings.NewReader(backupHeader)))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
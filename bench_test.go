@@ -0,0 +1,138 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	benchUpdate    = flag.Bool("bench.update", false, "record benchmark latencies as the new baseline")
+	benchTolerance = flag.Float64("bench.tolerance", 0.5, "allowed relative p99 regression against the baseline")
+)
+
+var benchBaselineFile = filepath.Join("testdata", "bench", "baseline.json")
+
+// benchBaselineMu guards benchBaselineFile, which every benchmark updates.
+var benchBaselineMu sync.Mutex
+
+type benchResult struct {
+	P50Ms float64 `json:"p50_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+func BenchmarkListItems(b *testing.B) {
+	for i := 0; i < 20; i++ {
+		factory.Item(b)
+	}
+
+	benchmarkRequests(b, func() {
+		client.Request(b, http.MethodGet, "/items", nil, http.StatusOK, nil)
+	})
+}
+
+func BenchmarkGetItem(b *testing.B) {
+	item := factory.Item(b)
+	path := fmt.Sprintf("/items/%d", item.ID)
+
+	benchmarkRequests(b, func() {
+		client.Request(b, http.MethodGet, path, nil, http.StatusOK, nil)
+	})
+}
+
+func BenchmarkCreateItem(b *testing.B) {
+	var ids []int
+	b.Cleanup(func() {
+		for _, id := range ids {
+			client.DeleteItem(b, id)
+		}
+	})
+
+	benchmarkRequests(b, func() {
+		item := client.CreateItem(b, Item{Name: "BenchmarkCreateItem", Price: 100})
+		ids = append(ids, item.ID)
+	})
+}
+
+// benchmarkRequests times every call of request, reports p50/p99 latency and
+// compares p99 with the recorded baseline.
+func benchmarkRequests(b *testing.B, request func()) {
+	b.Helper()
+	requireIntegration(b)
+	b.ReportAllocs()
+
+	latencies := make([]time.Duration, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		request()
+		latencies = append(latencies, time.Since(start))
+	}
+	b.StopTimer()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result := benchResult{
+		P50Ms: float64(quantile(latencies, 0.50)) / float64(time.Millisecond),
+		P99Ms: float64(quantile(latencies, 0.99)) / float64(time.Millisecond),
+	}
+	b.ReportMetric(result.P50Ms, "p50-ms")
+	b.ReportMetric(result.P99Ms, "p99-ms")
+
+	checkBenchBaseline(b, result)
+}
+
+// checkBenchBaseline fails the benchmark when p99 regressed by more than
+// -bench.tolerance, or records the result with -bench.update. The b.N == 1
+// probe run is never checked, and on update the last (largest) run wins.
+func checkBenchBaseline(b *testing.B, result benchResult) {
+	benchBaselineMu.Lock()
+	defer benchBaselineMu.Unlock()
+
+	baseline := map[string]benchResult{}
+	data, err := os.ReadFile(benchBaselineFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		b.Fatalf("Failed to read benchmark baseline: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			b.Fatalf("Failed to decode benchmark baseline: %v", err)
+		}
+	}
+
+	if *benchUpdate {
+		baseline[b.Name()] = result
+		data, err := json.MarshalIndent(baseline, "", "  ")
+		if err != nil {
+			b.Fatalf("Failed to encode benchmark baseline: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(benchBaselineFile), 0755); err != nil {
+			b.Fatalf("Failed to write benchmark baseline: %v", err)
+		}
+		if err := os.WriteFile(benchBaselineFile, append(data, '\n'), 0644); err != nil {
+			b.Fatalf("Failed to write benchmark baseline: %v", err)
+		}
+		return
+	}
+
+	if b.N == 1 {
+		return
+	}
+	expected, ok := baseline[b.Name()]
+	if !ok {
+		b.Logf("No baseline for %s in %s, nothing to compare with; record one with make bench-baseline", b.Name(), benchBaselineFile)
+		return
+	}
+	if limit := expected.P99Ms * (1 + *benchTolerance); result.P99Ms > limit {
+		b.Errorf("p99 latency %.2fms exceeds baseline %.2fms by more than %.0f%%", result.P99Ms, expected.P99Ms, *benchTolerance*100)
+	}
+}
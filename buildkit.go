@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// WithBuildKit builds the app image with docker buildx instead of the
+// daemon's classic builder, which skips the stages the image doesn't need
+// and reuses the build cache more eagerly.
+func WithBuildKit() Option {
+	return func(o *options) {
+		o.buildKit = true
+	}
+}
+
+// WithBuildCache builds the app image with BuildKit, importing its layer
+// cache from and exporting it to the buildx cache locations from and to,
+// e.g. "type=local,src=.buildcache" and "type=local,dest=.buildcache,mode=max",
+// so repeated runs only rebuild the layers that changed. Either may be
+// empty. Exporting to anything but inline or a registry needs a builder with
+// the docker-container driver, see docker buildx create.
+func WithBuildCache(from string, to string) Option {
+	return func(o *options) {
+		o.buildKit = true
+		if from != "" {
+			o.cacheFrom = append(o.cacheFrom, from)
+		}
+		if to != "" {
+			o.cacheTo = append(o.cacheTo, to)
+		}
+	}
+}
+
+// buildxArgs returns the arguments of docker building the image name with
+// buildx and loading it into the daemon.
+func buildxArgs(name string, build *dockertest.BuildOptions, labels map[string]string, cacheFrom []string, cacheTo []string) []string {
+	args := []string{"buildx", "build", "--load", "--progress", "plain",
+		"-t", name,
+		// BuildOptions.Dockerfile is relative to the context, -f isn't.
+		"-f", filepath.Join(build.ContextDir, build.Dockerfile)}
+	if build.Platform != "" {
+		args = append(args, "--platform", build.Platform)
+	}
+	for _, arg := range build.BuildArgs {
+		args = append(args, "--build-arg", arg.Name+"="+arg.Value)
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	for _, from := range cacheFrom {
+		args = append(args, "--cache-from", from)
+	}
+	for _, to := range cacheTo {
+		args = append(args, "--cache-to", to)
+	}
+	return append(args, build.ContextDir)
+}
+
+// buildxImage is buildImage with BuildKit. It runs the docker CLI, which
+// talks to the same daemon through DOCKER_HOST.
+func buildxImage(ctx context.Context, name string, out io.Writer, build *dockertest.BuildOptions, labels map[string]string, cacheFrom []string, cacheTo []string) error {
+	cmd := exec.CommandContext(ctx, "docker", buildxArgs(name, build, labels, cacheFrom, cacheTo)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not build %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildxArgs(t *testing.T) {
+	o := defaultOptions()
+	assert.False(t, o.buildKit)
+	WithBuildCache("type=local,src=.buildcache", "type=local,dest=.buildcache,mode=max")(o)
+	WithBuildCache("type=registry,ref=registry.internal/gopos:cache", "")(o)
+	assert.True(t, o.buildKit)
+
+	build := &dockertest.BuildOptions{
+		Dockerfile: "Dockerfile.test",
+		ContextDir: "build",
+		Platform:   "linux/amd64",
+		BuildArgs:  []docker.BuildArg{{Name: "RACE", Value: "true"}},
+	}
+	args := buildxArgs("app", build, map[string]string{runLabel: "1a2b3c4d"}, o.cacheFrom, o.cacheTo)
+	assert.Equal(t, []string{"buildx", "build", "--load", "--progress", "plain",
+		"-t", "app",
+		"-f", "build/Dockerfile.test",
+		"--platform", "linux/amd64",
+		"--build-arg", "RACE=true",
+		"--label", "gopos.run=1a2b3c4d",
+		"--cache-from", "type=local,src=.buildcache",
+		"--cache-from", "type=registry,ref=registry.internal/gopos:cache",
+		"--cache-to", "type=local,dest=.buildcache,mode=max",
+		"build"}, args)
+}
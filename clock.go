@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Clock tells the app the time. Business rules such as reservation expiry
+// read it instead of time.Now, so tests can move time forward.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// offsetClock runs offset ahead of the system clock, so time still passes
+// between jumps.
+type offsetClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (c *offsetClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset)
+}
+
+func (c *offsetClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+}
+
+func (c *offsetClock) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = 0
+}
+
+// now is the time on g's clock.
+func (g *GoPOS) now() time.Time {
+	if g.clock == nil {
+		return time.Now()
+	}
+	return g.clock.Now()
+}
+
+type clockAdvance struct {
+	Seconds int `json:"seconds" binding:"required,min=1"`
+}
+
+// enableFakeClock installs the test-only clock, which /_test/clock moves
+// forward and resets. It is enabled with GOPOS_FAKE_CLOCK and, like
+// enableFaultInjection, must be called before registerRoutes.
+func (g *GoPOS) enableFakeClock(router *gin.Engine) {
+	clock := &offsetClock{}
+	g.clock = clock
+
+	router.GET("/_test/clock", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"now": clock.Now()})
+	})
+	// Advancing also runs the reservation sweep, as it would have run had
+	// the time really passed.
+	router.POST("/_test/clock", func(c *gin.Context) {
+		var req clockAdvance
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		clock.Advance(time.Duration(req.Seconds) * time.Second)
+		now := clock.Now()
+		expired, err := g.store.ExpireReservations(c.Request.Context(), now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"now": now, "expired_reservations": expired})
+	})
+	router.DELETE("/_test/clock", func(c *gin.Context) {
+		clock.Reset()
+		c.Status(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// travelTime moves the app's clock forward by d, running what became due,
+// and turns it back when the test ends. Tests using it must not run in
+// parallel: the clock is shared by every client.
+func travelTime(t *testing.T, d time.Duration) {
+	t.Helper()
+	requireTestEndpoint(t, "/_test/clock")
+	client.Request(t, http.MethodPost, "/_test/clock", clockAdvance{Seconds: int(d.Seconds())}, http.StatusOK, nil)
+	t.Cleanup(func() {
+		client.Request(t, http.MethodDelete, "/_test/clock", nil, http.StatusNoContent, nil)
+	})
+}
+
+func TestReservationExpiresAfterTTL(t *testing.T) {
+	item := factory.Item(t, withStock(3))
+	path := fmt.Sprintf("/items/%d/reservations", item.ID)
+	client.Request(t, http.MethodPost, path, reservationRequest{Quantity: 3, TTLSeconds: 600}, http.StatusCreated, nil)
+
+	travelTime(t, 5*time.Minute)
+	assert.Equal(t, 0, client.GetItem(t, item.ID).Stock)
+
+	travelTime(t, 6*time.Minute)
+	assert.Equal(t, 3, client.GetItem(t, item.ID).Stock)
+}
+
+func TestOffsetClock(t *testing.T) {
+	clock := &offsetClock{}
+	clock.Advance(time.Hour)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), clock.Now(), time.Second)
+
+	clock.Reset()
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+}
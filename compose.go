@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// WithComposeFile boots the environment from an existing docker-compose
+// file instead of the harness's own containers, so a compose file kept for
+// local development can be reused as is. appService and dbService name its
+// services running the app and Postgres. The app must publish port 8000 and
+// Postgres port 5432, the database must be migrated by the compose file,
+// and its credentials must be those of WithDBCredentials. The test
+// endpoints are only there if the app's environment passes through
+// GOPOS_FAULT_INJECTION and GOPOS_FAKE_CLOCK, which compose gets set.
+// Sidecars, topologies, WithMySQL, WithPostgresTLS, WithIPv6Network and
+// WithRaceDetector can't be combined with a compose file.
+func WithComposeFile(path string, appService string, dbService string) Option {
+	return func(o *options) {
+		o.composeFile = path
+		o.composeServices = map[string]string{"app": appService, "db": dbService}
+	}
+}
+
+// checkCompose refuses the options the compose file would silently go
+// without.
+func checkCompose(o *options) error {
+	if o.topologyFile != "" {
+		return fmt.Errorf("compose file %s: topology %s is not supported with a compose file", o.composeFile, o.topologyFile)
+	}
+	if len(o.sidecars) > 0 {
+		return fmt.Errorf("compose file %s: sidecar %s is not supported with a compose file, add it to the file instead", o.composeFile, o.sidecars[0].name)
+	}
+	// The compose file decides the database, network and app build.
+	for _, c := range []struct {
+		option string
+		set    bool
+	}{
+		{"WithMySQL", o.mysql},
+		{"WithPostgresTLS", o.postgresTLS},
+		{"WithIPv6Network", o.ipv6},
+		{"WithRaceDetector", o.raceDetector},
+	} {
+		if c.set {
+			return fmt.Errorf("compose file %s: %s is not supported with a compose file, configure it in the file instead", o.composeFile, c.option)
+		}
+	}
+	return nil
+}
+
+// compose runs a docker compose command on the project of the environment.
+func compose(ctx context.Context, podman bool, file string, project string, args ...string) error {
+	engine := "docker"
+	if podman {
+		engine = "podman"
+	}
+	cmd := exec.CommandContext(ctx, engine, append([]string{"compose", "-p", project, "-f", file}, args...)...)
+	// For the compose file to pass on to the app, like the harness's own app
+	// container gets them.
+	cmd.Env = append(os.Environ(), "GOPOS_FAULT_INJECTION=true", "GOPOS_FAKE_CLOCK=true")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// createComposeEnvironment brings up the compose file of o and waits for its
+// services to be healthy.
+func createComposeEnvironment(ctx context.Context, pool *dockertest.Pool, o *options, host string) (_ *LocalTestContainer, err error) {
+	file, err := filepath.Abs(o.composeFile)
+	if err != nil {
+		return nil, err
+	}
+	project := "gopos-" + o.runID
+
+	// compose does the pulling, building and health checks in one go.
+	timeout := o.phaseTimeouts[PhasePull] + o.phaseTimeouts[PhaseBuild] + o.phaseTimeouts[PhaseHealth]
+	upCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer func() {
+		if err != nil {
+			compose(context.Background(), o.podman, file, project, "down", "-v", "--remove-orphans")
+		}
+	}()
+	if err := compose(upCtx, o.podman, file, project, "up", "-d", "--build", "--wait"); err != nil {
+		return nil, err
+	}
+
+	// Compose names containers <project>-<service>-<replica>.
+	resources := map[string]*dockertest.Resource{}
+	for role, service := range o.composeServices {
+		resource, ok := pool.ContainerByName(fmt.Sprintf("^/?%s-%s-1$", project, service))
+		if !ok {
+			return nil, fmt.Errorf("compose service %s is not running", service)
+		}
+		resources[role] = resource
+	}
+	network, err := findNetwork(project+"_default", pool)
+	if err != nil {
+		return nil, fmt.Errorf("could not list networks: %w", err)
+	}
+	if network == nil {
+		return nil, fmt.Errorf("compose network %s_default not found", project)
+	}
+
+	appport := resources["app"].GetPort("8000/tcp")
+	dbport := resources["db"].GetPort("5432/tcp")
+	if appport == "" || dbport == "" {
+		return nil, fmt.Errorf("the %s service must publish 8000 and the %s service 5432", o.composeServices["app"], o.composeServices["db"])
+	}
+	log.Printf("Compose project %s is up", project)
+
+	return &LocalTestContainer{
+		RunID:            o.runID,
+		Host:             host,
+		NetworkName:      network.Name,
+		AppContainerName: resources["app"].Container.Name[1:],
+		DBContainerName:  resources["db"].Container.Name[1:],
+		appcontainer:     resources["app"],
+		dbcontainer:      resources["db"],
+		appport:          appport,
+		pool:             pool,
+		network:          network.ID,
+		dbHostDSN:        o.testDSN(host, dbport),
+		dbAlias:          o.composeServices["db"],
+		appAlias:         o.composeServices["app"],
+		podman:           o.podman,
+		migrationsDir:    o.migrationsDir,
+		healthTimeout:    o.phaseTimeouts[PhaseHealth],
+		composeFile:      file,
+		composeProject:   project,
+	}, nil
+}
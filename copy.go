@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resource returns the "db" or "app" container or a sidecar.
+func (l LocalTestContainer) resource(container string) (*dockertest.Resource, error) {
+	var resource *dockertest.Resource
+	switch container {
+	case "db":
+		resource = l.dbcontainer
+	case "app":
+		resource = l.appcontainer
+	default:
+		resource = l.services[container]
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("no container %s", container)
+	}
+	return resource, nil
+}
+
+// CopyToContainer copies the local file src, or the files of the directory
+// src, into the directory dest of the "db" or "app" container or a sidecar,
+// e.g. a config or seed file. Unlike a bind mount, the copy doesn't depend
+// on src outliving the container, and works with a remote daemon.
+func (l LocalTestContainer) CopyToContainer(container string, src string, dest string) error {
+	resource, err := l.resource(container)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(dest, "/") {
+		return fmt.Errorf("%s isn't an absolute path", dest)
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTar(tw, src, dest); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	err = l.pool.Client.UploadToContainer(resource.Container.ID, docker.UploadToContainerOptions{
+		InputStream: &buf,
+		Path:        "/",
+	})
+	if err != nil {
+		return fmt.Errorf("could not copy %s to %s:%s: %w", src, container, dest, err)
+	}
+	return nil
+}
+
+// CopyFromContainer copies the file or directory src of the "db" or "app"
+// container or a sidecar into the local directory dest, e.g. an export the
+// app wrote.
+func (l LocalTestContainer) CopyFromContainer(container string, src string, dest string) error {
+	resource, err := l.resource(container)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = l.pool.Client.DownloadFromContainer(resource.Container.ID, docker.DownloadFromContainerOptions{
+		Path:         src,
+		OutputStream: &buf,
+	})
+	if err != nil {
+		return fmt.Errorf("could not copy %s:%s: %w", container, src, err)
+	}
+	return extractTar(&buf, dest)
+}
+
+// readFromContainer returns the content of the file path of a container,
+// which may have exited.
+func readFromContainer(pool *dockertest.Pool, containerID string, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := pool.Client.DownloadFromContainer(containerID, docker.DownloadFromContainerOptions{
+		Path:         path,
+		OutputStream: &buf,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(&buf)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s isn't a file", path)
+	}
+	return io.ReadAll(tr)
+}
+
+// extractTar writes the files and directories of a tar stream into dir,
+// refusing entries that would end up outside it.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside %s", header.Name, dir)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "seeds"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "seeds", "items.csv"), []byte("name,price\npen,1.5\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "config.yaml"), []byte("port: 8000\n"), 0o600))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, writeTar(tw, src, "/etc/gopos"))
+	assert.NoError(t, tw.Close())
+
+	dest := t.TempDir()
+	assert.NoError(t, extractTar(&buf, dest))
+	data, err := os.ReadFile(filepath.Join(dest, "etc", "gopos", "seeds", "items.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name,price\npen,1.5\n", string(data))
+	info, err := os.Stat(filepath.Join(dest, "etc", "gopos", "config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestExtractTarOutside(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escaped", Mode: 0o644, Size: 1}))
+	_, err := tw.Write([]byte("x"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	dir := t.TempDir()
+	assert.Error(t, extractTar(&buf, filepath.Join(dir, "dest")))
+	_, err = os.Stat(filepath.Join(dir, "escaped"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCopyContainer(t *testing.T) {
+	requireIntegration(t)
+
+	src := filepath.Join(t.TempDir(), "seed.csv")
+	assert.NoError(t, os.WriteFile(src, []byte("name,price\npen,1.5\n"), 0o644))
+	if err := localTestContainer.CopyToContainer("app", src, "/tmp/copytest"); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, code, err := localTestContainer.ExecApp([]string{"cat", "/tmp/copytest/seed.csv"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "name,price\npen,1.5\n", stdout)
+
+	dest := t.TempDir()
+	if err := localTestContainer.CopyFromContainer("app", "/tmp/copytest", dest); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "copytest", "seed.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name,price\npen,1.5\n", string(data))
+
+	assert.Error(t, localTestContainer.CopyToContainer("nope", src, "/tmp"))
+}
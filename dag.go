@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// startStep is a step of starting the environment, e.g. running a container
+// and waiting for it. It runs once the steps it depends on are done.
+type startStep struct {
+	name string
+	deps []string
+	run  func(ctx context.Context) error
+}
+
+// runSteps runs steps as their dependencies allow, the independent ones
+// concurrently, so e.g. the app image builds while the database starts. The
+// first step to fail cancels the others, and its error is returned once they
+// have stopped.
+func runSteps(ctx context.Context, steps []startStep) error {
+	deps := map[string][]string{}
+	for _, s := range steps {
+		if _, ok := deps[s.name]; ok {
+			return fmt.Errorf("duplicate step %s", s.name)
+		}
+		deps[s.name] = s.deps
+	}
+	if _, err := dependencyOrder(deps); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := map[string]chan struct{}{}
+	for _, s := range steps {
+		done[s.name] = make(chan struct{})
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, s := range steps {
+		wg.Add(1)
+		go func(s startStep) {
+			defer wg.Done()
+			for _, dep := range s.deps {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.run(ctx); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+				return
+			}
+			close(done[s.name])
+		}(s)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	// Without a failed step, steps only stop early when ctx is done.
+	for _, s := range steps {
+		select {
+		case <-done[s.name]:
+		default:
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// dependencyOrder sorts the names of deps so each comes after the names it
+// depends on, failing on unknown names and cycles.
+func dependencyOrder(deps map[string][]string) ([]string, error) {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var order []string
+	state := map[string]int{} // 1 while visiting, 2 once ordered
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("%s depends on unknown %s", name, dep)
+			}
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunSteps(t *testing.T) {
+	var mu sync.Mutex
+	var started []string
+	step := func(name string, deps ...string) startStep {
+		return startStep{name: name, deps: deps, run: func(ctx context.Context) error {
+			mu.Lock()
+			started = append(started, name)
+			mu.Unlock()
+			return nil
+		}}
+	}
+	err := runSteps(context.Background(), []startStep{
+		step("app", "migrate", "build"),
+		step("migrate", "db"),
+		step("db"),
+		step("build"),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, started, 4)
+	index := map[string]int{}
+	for i, name := range started {
+		index[name] = i
+	}
+	assert.Less(t, index["db"], index["migrate"])
+	assert.Less(t, index["migrate"], index["app"])
+	assert.Less(t, index["build"], index["app"])
+
+	// Independent steps run at the same time.
+	both := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	wg.Add(2)
+	meet := func(ctx context.Context) error {
+		wg.Done()
+		once.Do(func() {
+			go func() { wg.Wait(); close(both) }()
+		})
+		select {
+		case <-both:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("steps ran one after the other")
+		}
+	}
+	assert.NoError(t, runSteps(context.Background(), []startStep{{name: "db", run: meet}, {name: "build", run: meet}}))
+}
+
+func TestRunStepsFailure(t *testing.T) {
+	boom := errors.New("boom")
+	ran := false
+	err := runSteps(context.Background(), []startStep{
+		{name: "db", run: func(ctx context.Context) error { return boom }},
+		{name: "build", run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{name: "app", deps: []string{"db", "build"}, run: func(ctx context.Context) error {
+			ran = true
+			return nil
+		}},
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.False(t, ran, "a step ran after its dependency failed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = runSteps(ctx, []startStep{{name: "db", run: func(ctx context.Context) error { return nil }}, {name: "app", deps: []string{"db"}, run: func(ctx context.Context) error { return nil }}})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRunStepsInvalid(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+	for name, steps := range map[string][]startStep{
+		"unknown":   {{name: "app", deps: []string{"db"}, run: noop}},
+		"cycle":     {{name: "a", deps: []string{"b"}, run: noop}, {name: "b", deps: []string{"a"}, run: noop}},
+		"duplicate": {{name: "db", run: noop}, {name: "db", run: noop}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, runSteps(context.Background(), steps))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+)
+
+var (
+	datagenAdjectives = []string{"Organic", "Fresh", "Smoked", "Roasted", "Spiced", "Classic", "Large", "Small", "Vegan", "Homemade"}
+	datagenProducts   = []string{"Espresso", "Croissant", "Bagel", "Cheddar", "Sourdough", "Lemonade", "Granola", "Brownie", "Olive Oil", "Green Tea"}
+)
+
+// dataGen produces realistic test data from a seed, so any data set (and
+// any failure caused by it) can be reproduced exactly.
+type dataGen struct {
+	seed int64
+	rng  *rand.Rand
+}
+
+func newDataGen(seed int64) *dataGen {
+	return &dataGen{seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Derive returns a generator for name whose sequence only depends on the
+// parent seed and name, not on how much the parent was used before. Parallel
+// tests use it to stay reproducible regardless of scheduling.
+func (g *dataGen) Derive(name string) *dataGen {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return newDataGen(g.seed ^ int64(h.Sum64()))
+}
+
+// Seed returns the seed the generator was created with.
+func (g *dataGen) Seed() int64 {
+	return g.seed
+}
+
+// Item returns an item with a plausible name and a price between 0.50 and
+// 50.00 in cents.
+func (g *dataGen) Item() Item {
+	return Item{
+		Name: fmt.Sprintf("%s %s #%d",
+			datagenAdjectives[g.rng.Intn(len(datagenAdjectives))],
+			datagenProducts[g.rng.Intn(len(datagenProducts))],
+			g.rng.Intn(10000)),
+		Price: 50 + g.rng.Intn(4951),
+		Stock: g.rng.Intn(100),
+	}
+}
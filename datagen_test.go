@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDataGenIsDeterministic(t *testing.T) {
+	a := newDataGen(42)
+	b := newDataGen(42)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, a.Item(), b.Item())
+	}
+
+	assert.Equal(t, newDataGen(42).Derive("TestX").Item(), a.Derive("TestX").Item())
+	assert.NotEqual(t, a.Derive("TestX").Item(), a.Derive("TestY").Item())
+}
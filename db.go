@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"time"
+)
+
+// schemaVersion is the newest migration in db/migrations. Bump it together
+// with every new migration so `gopos db wait` keeps guarding the right schema.
+const schemaVersion = 7
+
+func newDBCmd() *cobra.Command {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Database maintenance commands.",
+	}
+
+	waitCmd := &cobra.Command{
+		Use:          "wait",
+		Short:        "Block until the database accepts connections and is migrated.",
+		SilenceUsage: true,
+		RunE:         dbWait,
+	}
+	waitCmd.Flags().Duration("timeout", 60*time.Second, "how long to wait before giving up")
+	waitCmd.Flags().Uint("version", schemaVersion, "migration version the database must be at")
+
+	seedCmd := &cobra.Command{
+		Use:          "seed",
+		Short:        "Fill the database with generated items.",
+		SilenceUsage: true,
+		RunE:         dbSeed,
+	}
+	seedCmd.Flags().Int("count", 100, "number of items to create")
+	seedCmd.Flags().Int64("seed", 1, "seed for the generated data")
+
+	importCmd := &cobra.Command{
+		Use:          "import [file]",
+		Short:        "Bulk load items from a CSV file with a name,price header, or stdin.",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE:         dbImport,
+	}
+
+	archiveCmd := &cobra.Command{
+		Use:          "archive",
+		Short:        "Move deleted items past their retention into the archive tables.",
+		SilenceUsage: true,
+		RunE:         dbArchive,
+	}
+	archiveCmd.Flags().Duration("retention", 30*24*time.Hour, "how long deleted items stay before they are archived")
+	archiveCmd.Flags().Int("batch", 500, "rows moved per transaction")
+
+	dbCmd.AddCommand(waitCmd)
+	dbCmd.AddCommand(seedCmd)
+	dbCmd.AddCommand(importCmd)
+	dbCmd.AddCommand(archiveCmd)
+	return dbCmd
+}
+
+func dbSeed(cmd *cobra.Command, args []string) error {
+	count, _ := cmd.Flags().GetInt("count")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	if err := postgresOnly("db seed"); err != nil {
+		return err
+	}
+
+	dsn, err := dbDSN()
+	if err != nil {
+		return err
+	}
+	db, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	store := newSQLItemStore(db)
+	gen := newDataGen(seed)
+	items := make([]Item, count)
+	for i := range items {
+		items[i] = gen.Item()
+	}
+	if _, err := store.CreateItems(cmd.Context(), items); err != nil {
+		return err
+	}
+	log.Printf("Created %d items from seed %d", count, seed)
+	return nil
+}
+
+func dbImport(cmd *cobra.Command, args []string) error {
+	if err := postgresOnly("db import"); err != nil {
+		return err
+	}
+	in := cmd.InOrStdin()
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dsn, err := dbDSN()
+	if err != nil {
+		return err
+	}
+	db, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := newSQLItemStore(db).ImportItems(cmd.Context(), in)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %d items", n)
+	return nil
+}
+
+func dbWait(cmd *cobra.Command, args []string) error {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	version, _ := cmd.Flags().GetUint("version")
+
+	db, err := openWaitDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	wait := 500 * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	for {
+		err = checkSchema(db, version)
+		if err == nil {
+			log.Printf("Database is ready at migration version %d", version)
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("database not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// openWaitDB opens the database db wait checks, which golang-migrate
+// migrated the same way on Postgres and MySQL.
+func openWaitDB() (*sql.DB, error) {
+	if usesMySQL() {
+		return openMySQL()
+	}
+	dsn, err := dbDSN()
+	if err != nil {
+		return nil, err
+	}
+	return openDB(dsn)
+}
+
+// checkSchema verifies the database is reachable and golang-migrate has
+// cleanly applied the expected version.
+func checkSchema(db *sql.DB, version uint) error {
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	current, dirty, err := schemaState(db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration version %d is dirty", current)
+	}
+	if current != version {
+		return fmt.Errorf("migration version is %d, expected %d", current, version)
+	}
+	return nil
+}
+
+// schemaState returns the migration version golang-migrate recorded and
+// whether it failed halfway.
+func schemaState(db *sql.DB) (uint, bool, error) {
+	var current uint
+	var dirty bool
+	err := db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&current, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, errors.New("no migrations applied")
+	}
+	return current, dirty, err
+}
@@ -0,0 +1,10 @@
+ALTER TABLE items ADD COLUMN stock INT NOT NULL DEFAULT 0 CONSTRAINT items_stock_check CHECK (stock >= 0);
+
+CREATE TABLE IF NOT EXISTS reservations (
+                                            id SERIAL PRIMARY KEY,
+                                            item_id INT NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+                                            quantity INT NOT NULL CHECK (quantity > 0),
+                                            expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX reservations_expires_at_idx ON reservations (expires_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS tags (
+                                    id SERIAL PRIMARY KEY,
+                                    name TEXT NOT NULL CONSTRAINT tags_name_key UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS item_tags (
+                                         item_id INT NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+                                         tag_id INT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+                                         PRIMARY KEY (item_id, tag_id)
+);
+
+-- The primary key serves lookups by item, this one filtering by tag.
+CREATE INDEX item_tags_tag_id_idx ON item_tags (tag_id, item_id);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS tenants (
+                                       name TEXT PRIMARY KEY,
+                                       database TEXT NOT NULL CONSTRAINT tenants_database_key UNIQUE,
+                                       created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+                                        id SERIAL PRIMARY KEY,
+                                        url TEXT NOT NULL,
+                                        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Deliveries waiting for their next attempt. Delivered ones are deleted.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+                                                  id SERIAL PRIMARY KEY,
+                                                  webhook_id INT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                                                  payload JSONB NOT NULL,
+                                                  attempts INT NOT NULL DEFAULT 0,
+                                                  last_error TEXT NOT NULL DEFAULT '',
+                                                  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                                  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_deliveries_next_attempt_at_idx ON webhook_deliveries (next_attempt_at);
+
+-- Deliveries that failed every attempt, kept until they are replayed.
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+                                                    id INT PRIMARY KEY,
+                                                    webhook_id INT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+                                                    payload JSONB NOT NULL,
+                                                    attempts INT NOT NULL,
+                                                    last_error TEXT NOT NULL,
+                                                    created_at TIMESTAMPTZ NOT NULL,
+                                                    failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX webhook_dead_letters_webhook_id_idx ON webhook_dead_letters (webhook_id);
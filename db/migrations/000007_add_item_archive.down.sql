@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS archive_runs;
+DROP TABLE IF EXISTS items_archive;
+DELETE FROM items WHERE deleted_at IS NOT NULL;
+ALTER TABLE items DROP COLUMN IF EXISTS deleted_at;
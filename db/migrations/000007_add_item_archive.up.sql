@@ -0,0 +1,23 @@
+ALTER TABLE items ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Lets the archiver find the deleted items without scanning the live ones.
+CREATE INDEX items_deleted_at_idx ON items (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS items_archive (
+                                             id INT PRIMARY KEY,
+                                             name TEXT NOT NULL,
+                                             price INT NOT NULL,
+                                             stock INT NOT NULL,
+                                             deleted_at TIMESTAMPTZ NOT NULL,
+                                             archived_at TIMESTAMPTZ NOT NULL
+);
+
+-- One row per table an archiver run worked on, updated after every batch.
+CREATE TABLE IF NOT EXISTS archive_runs (
+                                            id SERIAL PRIMARY KEY,
+                                            table_name TEXT NOT NULL,
+                                            cutoff TIMESTAMPTZ NOT NULL,
+                                            archived BIGINT NOT NULL DEFAULT 0,
+                                            started_at TIMESTAMPTZ NOT NULL,
+                                            finished_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS reservations;
+ALTER TABLE items DROP CHECK items_stock_check, DROP COLUMN stock;
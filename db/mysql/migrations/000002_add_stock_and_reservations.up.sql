@@ -0,0 +1,10 @@
+ALTER TABLE items ADD COLUMN stock INT NOT NULL DEFAULT 0, ADD CONSTRAINT items_stock_check CHECK (stock >= 0);
+
+CREATE TABLE IF NOT EXISTS reservations (
+                                            id INT AUTO_INCREMENT PRIMARY KEY,
+                                            item_id INT NOT NULL,
+                                            quantity INT NOT NULL CHECK (quantity > 0),
+                                            expires_at DATETIME(6) NOT NULL,
+                                            FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE,
+                                            INDEX reservations_expires_at_idx (expires_at)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags (
+                                    id INT AUTO_INCREMENT PRIMARY KEY,
+                                    name VARCHAR(255) NOT NULL,
+                                    CONSTRAINT tags_name_key UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS item_tags (
+                                         item_id INT NOT NULL,
+                                         tag_id INT NOT NULL,
+                                         PRIMARY KEY (item_id, tag_id),
+                                         FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE,
+                                         FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE,
+                                         -- The primary key serves lookups by item, this one filtering by tag.
+                                         INDEX item_tags_tag_id_idx (tag_id, item_id)
+);
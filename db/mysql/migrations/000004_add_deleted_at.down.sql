@@ -0,0 +1,2 @@
+DELETE FROM items WHERE deleted_at IS NOT NULL;
+ALTER TABLE items DROP INDEX items_deleted_at_idx, DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+-- Deleted items are kept, like on Postgres, but there is no archiver for
+-- MySQL yet.
+ALTER TABLE items ADD COLUMN deleted_at DATETIME(6), ADD INDEX items_deleted_at_idx (deleted_at);
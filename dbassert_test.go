@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// loadFixtures inserts the rows in each YAML fixture file. A file maps table
+// names to lists of rows; tables are loaded in file order so foreign keys
+// can refer to rows loaded earlier.
+func loadFixtures(t testing.TB, db *sql.DB, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		tables := doc.Content[0].Content
+		for i := 0; i+1 < len(tables); i += 2 {
+			var rows []map[string]any
+			if err := tables[i+1].Decode(&rows); err != nil {
+				t.Fatalf("%s: table %s: %v", file, tables[i].Value, err)
+			}
+			if err := insertRows(db, tables[i].Value, rows); err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+		}
+	}
+}
+
+func insertRows(db *sql.DB, table string, rows []map[string]any) error {
+	hasID := false
+	for _, row := range rows {
+		columns, args := rowColumns(row)
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			pgx.Identifier{table}.Sanitize(), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+		if _, err := db.Exec(query, args...); err != nil {
+			return fmt.Errorf("insert into %s: %w", table, err)
+		}
+		_, ok := row["id"]
+		hasID = hasID || ok
+	}
+
+	if hasID {
+		// Rows with explicit ids don't advance the serial sequence, so move it
+		// past them before the test creates rows of its own.
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence($1, 'id'), (SELECT max(id) FROM %s))", pgx.Identifier{table}.Sanitize())
+		if _, err := db.Exec(query, table); err != nil {
+			return fmt.Errorf("reset %s id sequence: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// rowColumns returns the quoted column names of row in a stable order, and
+// the matching values.
+func rowColumns(row map[string]any) ([]string, []any) {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	columns := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, k := range keys {
+		columns[i] = pgx.Identifier{k}.Sanitize()
+		args[i] = row[k]
+	}
+	return columns, args
+}
+
+// AssertRowCount checks that table holds exactly want rows.
+func AssertRowCount(t testing.TB, db *sql.DB, table string, want int) {
+	t.Helper()
+	var got int
+	if err := db.QueryRow("SELECT count(*) FROM " + pgx.Identifier{table}.Sanitize()).Scan(&got); err != nil {
+		t.Fatalf("Failed to count rows in %s: %v", table, err)
+	}
+	if got != want {
+		t.Errorf("%s has %d rows, want %d", table, got, want)
+	}
+}
+
+// AssertRowExists checks that table holds a row with the given column
+// values.
+func AssertRowExists(t testing.TB, db *sql.DB, table string, values map[string]any) {
+	t.Helper()
+	columns, args := rowColumns(values)
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s)", pgx.Identifier{table}.Sanitize(), strings.Join(conditions, " AND "))
+
+	var exists bool
+	if err := db.QueryRow(query, args...).Scan(&exists); err != nil {
+		t.Fatalf("Failed to query %s: %v", table, err)
+	}
+	if !exists {
+		t.Errorf("%s has no row matching %v", table, values)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	t.Parallel()
+
+	db := requireFreshDB(t)
+	if err := migrateUp(db, "./db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	loadFixtures(t, db, "testdata/fixtures/items.yaml")
+
+	AssertRowCount(t, db, "items", 2)
+	AssertRowExists(t, db, "items", map[string]any{"id": 1, "name": "Widget", "price": 250})
+
+	// Persisted through the store, checked in the table.
+	created, err := newSQLItemStore(db).CreateItem(context.Background(), Item{Name: "TestFixtures", Price: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertRowCount(t, db, "items", 3)
+	AssertRowExists(t, db, "items", map[string]any{"id": created.ID, "name": "TestFixtures"})
+}
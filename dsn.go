@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DSN describes a PostgreSQL connection. It renders to the URL form accepted
+// by the driver and to a redacted form that is safe to log.
+type DSN struct {
+	User            string
+	Password        string
+	Host            string
+	Port            int
+	DBName          string
+	SSLMode         string
+	SSLRootCert     string
+	SSLCert         string
+	SSLKey          string
+	ApplicationName string
+	// Params holds any other connection parameters, passed through as is.
+	Params url.Values
+}
+
+// ParseDSN parses a postgres:// or postgresql:// connection URL, or a libpq
+// key=value connection string like "host=db dbname=items".
+func ParseDSN(s string) (DSN, error) {
+	if !strings.Contains(s, "://") {
+		return parseKeywordDSN(s)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		// url.Parse echoes the input, which would leak the password.
+		return DSN{}, errors.New("invalid connection url")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return DSN{}, fmt.Errorf("unsupported connection url scheme %q", u.Scheme)
+	}
+
+	d := DSN{
+		Host:   u.Hostname(),
+		DBName: trimSlash(u.Path),
+	}
+	if u.User != nil {
+		d.User = u.User.Username()
+		d.Password, _ = u.User.Password()
+	}
+	if p := u.Port(); p != "" {
+		d.Port, err = strconv.Atoi(p)
+		if err != nil {
+			return DSN{}, fmt.Errorf("invalid port %q", p)
+		}
+	}
+
+	q := u.Query()
+	if d.Host == "" {
+		d.Host = pop(q, "host")
+		if p := pop(q, "port"); p != "" && d.Port == 0 {
+			d.Port, err = strconv.Atoi(p)
+			if err != nil {
+				return DSN{}, fmt.Errorf("invalid port %q", p)
+			}
+		}
+	}
+	d.SSLMode = pop(q, "sslmode")
+	d.SSLRootCert = pop(q, "sslrootcert")
+	d.SSLCert = pop(q, "sslcert")
+	d.SSLKey = pop(q, "sslkey")
+	d.ApplicationName = pop(q, "application_name")
+	if len(q) > 0 {
+		d.Params = q
+	}
+	return d, nil
+}
+
+// parseKeywordDSN parses a key=value connection string. As in libpq, values
+// may be single-quoted to hold spaces, and a backslash escapes the next
+// character. Errors name keys only, never values, which may be passwords.
+func parseKeywordDSN(s string) (DSN, error) {
+	q := url.Values{}
+	rest := strings.TrimLeftFunc(s, unicode.IsSpace)
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return DSN{}, errors.New("invalid connection string: expected key=value")
+		}
+		key := strings.TrimSpace(rest[:eq])
+		if key == "" || strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+			return DSN{}, errors.New("invalid connection string: expected key=value")
+		}
+		rest = strings.TrimLeftFunc(rest[eq+1:], unicode.IsSpace)
+
+		var value strings.Builder
+		quoted := strings.HasPrefix(rest, "'")
+		if quoted {
+			rest = rest[1:]
+		}
+		closed := false
+		for rest != "" {
+			c := rest[0]
+			if c == '\\' && len(rest) > 1 {
+				value.WriteByte(rest[1])
+				rest = rest[2:]
+				continue
+			}
+			if quoted && c == '\'' {
+				rest = rest[1:]
+				closed = true
+				break
+			}
+			if !quoted && unicode.IsSpace(rune(c)) {
+				break
+			}
+			value.WriteByte(c)
+			rest = rest[1:]
+		}
+		if quoted && !closed {
+			return DSN{}, fmt.Errorf("invalid connection string: unterminated quoted value of %s", key)
+		}
+		q.Set(key, value.String())
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+
+	d := DSN{
+		User:     pop(q, "user"),
+		Password: pop(q, "password"),
+		Host:     pop(q, "host"),
+		DBName:   pop(q, "dbname"),
+	}
+	if p := pop(q, "port"); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return DSN{}, fmt.Errorf("invalid port %q", p)
+		}
+		d.Port = port
+	}
+	d.SSLMode = pop(q, "sslmode")
+	d.SSLRootCert = pop(q, "sslrootcert")
+	d.SSLCert = pop(q, "sslcert")
+	d.SSLKey = pop(q, "sslkey")
+	d.ApplicationName = pop(q, "application_name")
+	if len(q) > 0 {
+		d.Params = q
+	}
+	return d, nil
+}
+
+// SetStatementTimeout makes the server abort any statement of the session
+// that runs longer than timeout. Zero leaves the server's default.
+func (d *DSN) SetStatementTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	if d.Params == nil {
+		d.Params = url.Values{}
+	}
+	d.Params.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+}
+
+// String renders the full connection URL, including the password.
+func (d DSN) String() string {
+	return d.url().String()
+}
+
+// Redacted renders the connection URL with the password masked.
+func (d DSN) Redacted() string {
+	return d.url().Redacted()
+}
+
+func (d DSN) url() *url.URL {
+	q := url.Values{}
+	for k, v := range d.Params {
+		q[k] = v
+	}
+	set(q, "sslmode", d.SSLMode)
+	set(q, "sslrootcert", d.SSLRootCert)
+	set(q, "sslcert", d.SSLCert)
+	set(q, "sslkey", d.SSLKey)
+	set(q, "application_name", d.ApplicationName)
+
+	// A unix socket directory can't be the URL's host, so it goes in the
+	// query, as does the port naming the socket file.
+	host := d.Host
+	if strings.HasPrefix(d.Host, "/") {
+		host = ""
+		q.Set("host", d.Host)
+		if d.Port != 0 {
+			q.Set("port", strconv.Itoa(d.Port))
+		}
+	} else if d.Port != 0 {
+		host = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	}
+
+	u := &url.URL{
+		Scheme:   "postgres",
+		Host:     host,
+		Path:     "/" + d.DBName,
+		RawQuery: q.Encode(),
+	}
+	if d.Password != "" {
+		u.User = url.UserPassword(d.User, d.Password)
+	} else if d.User != "" {
+		u.User = url.User(d.User)
+	}
+	return u
+}
+
+func trimSlash(s string) string {
+	if len(s) > 0 && s[0] == '/' {
+		return s[1:]
+	}
+	return s
+}
+
+func pop(q url.Values, key string) string {
+	v := q.Get(key)
+	q.Del(key)
+	return v
+}
+
+func set(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	dsn, err := ParseDSN("postgresql://gopos:s3cret@db:5433/items?sslmode=verify-full&sslrootcert=/certs/ca.pem&application_name=gopos&connect_timeout=5")
+	if err != nil {
+		t.Fatalf("Failed to parse dsn: %v", err)
+	}
+
+	assert.Equal(t, "gopos", dsn.User)
+	assert.Equal(t, "s3cret", dsn.Password)
+	assert.Equal(t, "db", dsn.Host)
+	assert.Equal(t, 5433, dsn.Port)
+	assert.Equal(t, "items", dsn.DBName)
+	assert.Equal(t, "verify-full", dsn.SSLMode)
+	assert.Equal(t, "/certs/ca.pem", dsn.SSLRootCert)
+	assert.Equal(t, "gopos", dsn.ApplicationName)
+	assert.Equal(t, "5", dsn.Params.Get("connect_timeout"))
+}
+
+func TestParseKeywordDSN(t *testing.T) {
+	dsn, err := ParseDSN(`host=db port=5433 user=gopos password='s3 cr\'et' dbname = items sslmode=verify-full application_name=gopos connect_timeout=5`)
+	if err != nil {
+		t.Fatalf("Failed to parse dsn: %v", err)
+	}
+
+	assert.Equal(t, DSN{
+		User:            "gopos",
+		Password:        "s3 cr'et",
+		Host:            "db",
+		Port:            5433,
+		DBName:          "items",
+		SSLMode:         "verify-full",
+		ApplicationName: "gopos",
+		Params:          map[string][]string{"connect_timeout": {"5"}},
+	}, dsn)
+
+	// The URL form connects to the same database.
+	config, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		t.Fatalf("pgx rejected the dsn: %v", err)
+	}
+	assert.Equal(t, "s3 cr'et", config.Password)
+	assert.Equal(t, "items", config.Database)
+
+	// A unix socket directory as host survives the URL form.
+	dsn, err = ParseDSN("host=/var/run/postgresql port=5433 user=gopos dbname=items")
+	if err != nil {
+		t.Fatalf("Failed to parse dsn: %v", err)
+	}
+	config, err = pgx.ParseConfig(dsn.String())
+	if err != nil {
+		t.Fatalf("pgx rejected the dsn %s: %v", dsn.String(), err)
+	}
+	assert.Equal(t, "/var/run/postgresql", config.Host)
+	assert.EqualValues(t, 5433, config.Port)
+	assert.Equal(t, "items", config.Database)
+	parsed, err := ParseDSN(dsn.String())
+	assert.NoError(t, err)
+	assert.Equal(t, dsn, parsed)
+
+	for _, s := range []string{"host=db password='s3cret", "host=db s3cret", "host=db port=s3cret"} {
+		_, err := ParseDSN(s)
+		assert.Error(t, err, s)
+	}
+	_, err = ParseDSN("host=db password='s3cret")
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestParseDSNDoesNotLeakPassword(t *testing.T) {
+	_, err := ParseDSN("postgres://gopos:s3cret@db:port/items")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cret")
+}
+
+func TestDSNRedacted(t *testing.T) {
+	dsn := DSN{User: "gopos", Password: "s3cret", Host: "db", Port: 5432, DBName: "items", SSLMode: "disable"}
+
+	assert.Equal(t, "postgres://gopos:s3cret@db:5432/items?sslmode=disable", dsn.String())
+	assert.NotContains(t, dsn.Redacted(), "s3cret")
+
+	parsed, err := ParseDSN(dsn.String())
+	assert.NoError(t, err)
+	assert.Equal(t, dsn, parsed)
+}
+
+func TestDSNAcceptedByDriver(t *testing.T) {
+	dsn := DSN{User: "gopos", Password: "s3cret", Host: "db", Port: 5433, DBName: "items", SSLMode: "disable", ApplicationName: "gopos"}
+
+	config, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		t.Fatalf("pgx rejected the dsn: %v", err)
+	}
+	assert.Equal(t, "db", config.Host)
+	assert.EqualValues(t, 5433, config.Port)
+	assert.Equal(t, "gopos", config.RuntimeParams["application_name"])
+}
+
+func TestDSNStatementTimeout(t *testing.T) {
+	dsn := DSN{Host: "db", DBName: "items"}
+	dsn.SetStatementTimeout(1500 * time.Millisecond)
+
+	config, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		t.Fatalf("pgx rejected the dsn: %v", err)
+	}
+	assert.Equal(t, "1500", config.RuntimeParams["statement_timeout"])
+
+	dsn = DSN{Host: "db"}
+	dsn.SetStatementTimeout(0)
+	assert.Nil(t, dsn.Params)
+}
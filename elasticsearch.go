@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net"
+)
+
+const elasticsearchImage = "docker.elastic.co/elasticsearch/elasticsearch:8.14.1"
+
+// elasticsearchMemory caps the Elasticsearch container, with the JVM heap
+// at half of it.
+const elasticsearchMemory = 1 << 30
+
+// WithElasticsearch starts a single-node Elasticsearch without security on
+// the test network and points the app at it with ELASTICSEARCH_URL. Once
+// the cluster is up, bootstrap is called with its URL to create indices and
+// templates; it may be nil. Use ElasticsearchURL to reach it from the tests.
+func WithElasticsearch(bootstrap func(ctx context.Context, url string) error) Option {
+	return func(o *options) {
+		if c := o.container("elasticsearch"); c.memory == 0 {
+			c.memory = elasticsearchMemory
+		}
+		o.addSidecar(sidecar{
+			name:   "elasticsearch",
+			image:  elasticsearchImage,
+			appEnv: []string{"ELASTICSEARCH_URL=http://elasticsearch:9200"},
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return createElasticsearch(ctx, pool, network, o, host, bootstrap)
+			},
+		})
+	}
+}
+
+// createElasticsearch starts Elasticsearch, waits for the cluster to turn
+// yellow, which is as green as a single node gets with replicas, and runs
+// bootstrap.
+func createElasticsearch(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, bootstrap func(ctx context.Context, url string) error) (*dockertest.Resource, error) {
+	heap := o.container("elasticsearch").memory / 2 >> 20
+	resource, err := startService(ctx, pool, network, o, host, "elasticsearch", ServiceSpec{
+		Image: elasticsearchImage,
+		Env: map[string]string{
+			"discovery.type":         "single-node",
+			"xpack.security.enabled": "false",
+			"ES_JAVA_OPTS":           fmt.Sprintf("-Xms%dm -Xmx%dm", heap, heap),
+		},
+		Ports: []string{"9200"},
+		Wait: WaitSpec{HTTP: &HTTPWait{
+			Port: "9200",
+			Path: "/_cluster/health?wait_for_status=yellow&timeout=1s",
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bootstrap != nil {
+		url := "http://" + net.JoinHostPort(host, resource.GetPort("9200/tcp"))
+		if err := bootstrap(ctx, url); err != nil {
+			resource.Close()
+			return nil, fmt.Errorf("elasticsearch bootstrap failed: %w", err)
+		}
+	}
+	return resource, nil
+}
+
+// ElasticsearchURL returns the URL the tests reach the WithElasticsearch
+// cluster at.
+func (l LocalTestContainer) ElasticsearchURL() (string, error) {
+	addr, err := l.ServiceAddr("elasticsearch", "9200")
+	if err != nil {
+		return "", err
+	}
+	return "http://" + addr, nil
+}
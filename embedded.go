@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"net"
+	"os"
+)
+
+// TestDatabase is a migrated Postgres database for tests that only need the
+// data layer and not the app container.
+type TestDatabase struct {
+	dsn  DSN
+	stop func() error
+}
+
+// DSN returns the connection string of the test database.
+func (d *TestDatabase) DSN() DSN {
+	return d.dsn
+}
+
+// Open connects to the test database.
+func (d *TestDatabase) Open() (*sql.DB, error) {
+	return sql.Open(dbDriver, d.dsn.String())
+}
+
+// Close stops the database if this TestDatabase started it.
+func (d *TestDatabase) Close() error {
+	if d.stop == nil {
+		return nil
+	}
+	return d.stop()
+}
+
+// StartEmbeddedDatabase runs Postgres as a local process through
+// embedded-postgres instead of a container and applies the migrations in
+// migrationsDir. The Postgres binaries are downloaded and cached on first use.
+func StartEmbeddedDatabase(migrationsDir string) (*TestDatabase, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	runtimeDir, err := os.MkdirTemp("", "embedded-postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := DSN{
+		User:     "user_name",
+		Password: "secret",
+		Host:     "localhost",
+		Port:     port,
+		DBName:   "dbname",
+		SSLMode:  "disable",
+	}
+	pg := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Username(dsn.User).
+		Password(dsn.Password).
+		Database(dsn.DBName).
+		Port(uint32(port)).
+		RuntimePath(runtimeDir))
+	if err := pg.Start(); err != nil {
+		os.RemoveAll(runtimeDir)
+		return nil, err
+	}
+
+	d := &TestDatabase{
+		dsn: dsn,
+		stop: func() error {
+			defer os.RemoveAll(runtimeDir)
+			return pg.Stop()
+		},
+	}
+
+	db, err := d.Open()
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	defer db.Close()
+	if err := migrateUp(db, migrationsDir); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
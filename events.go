@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// itemEvent is published to GOPOS_ITEM_TOPIC and the webhooks when an item
+// is created, updated or deleted. Deleted events only carry the item's ID.
+type itemEvent struct {
+	Type string `json:"type"`
+	Item Item   `json:"item"`
+}
+
+// eventPublisher passes item events on, to Kafka or the webhooks.
+type eventPublisher interface {
+	Publish(ctx context.Context, event itemEvent) error
+}
+
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// enableEvents publishes item events to the brokers of GOPOS_KAFKA_BROKERS,
+// if set, and returns the writer to close on shutdown. Like
+// enableFaultInjection it must be called before registerRoutes.
+func (g *GoPOS) enableEvents() *kafka.Writer {
+	brokers := viper.GetString("GOPOS_KAFKA_BROKERS")
+	if brokers == "" {
+		return nil
+	}
+	viper.SetDefault("GOPOS_ITEM_TOPIC", "item-events")
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        viper.GetString("GOPOS_ITEM_TOPIC"),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Writes are synchronous, don't hold requests waiting for a batch.
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	log.Printf("Publishing item events to %s", writer.Topic)
+	g.store = eventStore{g.store, kafkaPublisher{writer}}
+	return writer
+}
+
+// kafkaPublisher writes events keyed by the item's ID, so the events of an
+// item stay in order.
+type kafkaPublisher struct {
+	writer messageWriter
+}
+
+func (p kafkaPublisher) Publish(ctx context.Context, event itemEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(strconv.Itoa(event.Item.ID)), Value: value})
+}
+
+// eventStore publishes an itemEvent for every write that succeeded. The
+// write isn't undone when publishing fails; the error is logged.
+type eventStore struct {
+	ItemStore
+	publisher eventPublisher
+}
+
+func (s eventStore) publish(ctx context.Context, typ string, item Item) {
+	if err := s.publisher.Publish(ctx, itemEvent{Type: typ, Item: item}); err != nil {
+		log.Printf("Could not publish %s event of item %d: %v", typ, item.ID, err)
+	}
+}
+
+func (s eventStore) CreateItem(ctx context.Context, item Item) (Item, error) {
+	created, err := s.ItemStore.CreateItem(ctx, item)
+	if err == nil {
+		s.publish(ctx, "created", created)
+	}
+	return created, err
+}
+
+func (s eventStore) UpdateItem(ctx context.Context, id int, item Item) (Item, error) {
+	updated, err := s.ItemStore.UpdateItem(ctx, id, item)
+	if err == nil {
+		s.publish(ctx, "updated", updated)
+	}
+	return updated, err
+}
+
+func (s eventStore) DeleteItem(ctx context.Context, id int) error {
+	err := s.ItemStore.DeleteItem(ctx, id)
+	if err == nil {
+		s.publish(ctx, "deleted", Item{ID: id})
+	}
+	return err
+}
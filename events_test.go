@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeWriter records the messages written to it.
+type fakeWriter struct {
+	messages []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) events(t *testing.T) []itemEvent {
+	var events []itemEvent
+	for _, msg := range w.messages {
+		var event itemEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strconv.Itoa(event.Item.ID), string(msg.Key))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventStore(t *testing.T) {
+	ctx := context.Background()
+	writer := &fakeWriter{}
+	store := eventStore{newMemItemStore(), kafkaPublisher{writer}}
+
+	item, err := store.CreateItem(ctx, Item{Name: "TestEventStore", Price: 1, Stock: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Stock = 2
+	if _, err := store.UpdateItem(ctx, item.ID, item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReserveItem(ctx, item.ID, 1, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteItem(ctx, item.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Failed writes publish nothing.
+	_, err = store.UpdateItem(ctx, item.ID, item)
+	assert.True(t, errors.Is(err, errItemNotFound))
+	assert.True(t, errors.Is(store.DeleteItem(ctx, item.ID), errItemNotFound))
+
+	assert.Equal(t, []itemEvent{
+		{Type: "created", Item: Item{ID: item.ID, Name: "TestEventStore", Price: 1, Stock: 1}},
+		{Type: "updated", Item: item},
+		{Type: "deleted", Item: Item{ID: item.ID}},
+	}, writer.events(t))
+}
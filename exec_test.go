@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExecApp(t *testing.T) {
+	requirePostgres(t)
+
+	_, stderr, code, err := localTestContainer.ExecApp([]string{"/gopos", "db", "wait", "--timeout", "5s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stderr, "Database is ready")
+
+	stdout, stderr, code, err := localTestContainer.ExecApp([]string{"sh", "-c", "echo out; echo err >&2; exit 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "out\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+	assert.Equal(t, 3, code)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// factory creates valid entities through the API with generated defaults and
+// deletes them again when the test finishes, so tests only set the fields
+// they care about and never depend on each other's data.
+var factory testFactory
+
+type testFactory struct{}
+
+type itemOption func(*Item)
+
+func withName(name string) itemOption {
+	return func(i *Item) {
+		i.Name = name
+	}
+}
+
+func withPrice(price int) itemOption {
+	return func(i *Item) {
+		i.Price = price
+	}
+}
+
+func withStock(stock int) itemOption {
+	return func(i *Item) {
+		i.Stock = stock
+	}
+}
+
+// testDataGen seeds the data of every test. Set TEST_SEED to the seed a
+// failed test printed to reproduce its data.
+var testDataGen = newDataGen(testSeed())
+
+// testGens holds each test's own generator, derived from testDataGen.
+var testGens sync.Map
+
+func testSeed() int64 {
+	if s := os.Getenv("TEST_SEED"); s != "" {
+		seed, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			return seed
+		}
+	}
+	return time.Now().UnixNano()
+}
+
+// dataGenFor returns the generator for t and prints the seed if t fails.
+func dataGenFor(t testing.TB) *dataGen {
+	if g, ok := testGens.Load(t); ok {
+		return g.(*dataGen)
+	}
+	g := testDataGen.Derive(t.Name())
+	testGens.Store(t, g)
+	t.Cleanup(func() {
+		testGens.Delete(t)
+		if t.Failed() {
+			t.Logf("Test data generated with TEST_SEED=%d", testDataGen.Seed())
+		}
+	})
+	return g
+}
+
+// Item creates an item and registers its deletion with t.Cleanup.
+func (testFactory) Item(t testing.TB, opts ...itemOption) Item {
+	t.Helper()
+
+	item := dataGenFor(t).Item()
+	for _, opt := range opts {
+		opt(&item)
+	}
+
+	created := client.CreateItem(t, item)
+	t.Cleanup(func() {
+		// The test may have deleted the item itself.
+		status, body := client.Do(t, http.MethodDelete, fmt.Sprintf("/items/%d", created.ID), nil)
+		if status != http.StatusNoContent && status != http.StatusNotFound {
+			t.Errorf("Failed to clean up item %d: status %d: %s", created.ID, status, body)
+		}
+	})
+	return created
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errInjectedFault = errors.New("injected database fault")
+
+// fault describes a failure to inject into requests matching Method and Path,
+// the route pattern such as /items/:id. An empty Method or Path matches any.
+type fault struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// LatencyMs delays the request before it is handled.
+	LatencyMs int `json:"latency_ms"`
+	// Status, when set, is returned instead of calling the handler.
+	Status int `json:"status"`
+	// DBError makes every store call of the request fail.
+	DBError bool `json:"db_error"`
+	// Times limits how many requests the fault applies to; 0 means until the
+	// faults are cleared.
+	Times int `json:"times"`
+}
+
+// faultInjector is test-only middleware that makes requests fail on demand.
+// It is enabled with GOPOS_FAULT_INJECTION and configured through
+// /_test/faults.
+type faultInjector struct {
+	mu     sync.Mutex
+	faults []*fault
+}
+
+type dbFaultKey struct{}
+
+func (f *faultInjector) register(router *gin.Engine) {
+	router.Use(f.middleware)
+	router.GET("/_test/faults", f.list)
+	router.POST("/_test/faults", f.add)
+	router.DELETE("/_test/faults", f.clear)
+}
+
+func (f *faultInjector) middleware(c *gin.Context) {
+	active := f.match(c.Request.Method, c.FullPath())
+	if active == nil {
+		c.Next()
+		return
+	}
+
+	if active.LatencyMs > 0 {
+		time.Sleep(time.Duration(active.LatencyMs) * time.Millisecond)
+	}
+	if active.Status != 0 {
+		c.AbortWithStatusJSON(active.Status, gin.H{"error": "injected fault"})
+		return
+	}
+	if active.DBError {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), dbFaultKey{}, true))
+	}
+	c.Next()
+}
+
+// match returns a copy of the first fault matching the request and uses up
+// one of its Times.
+func (f *faultInjector) match(method, path string) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, ft := range f.faults {
+		if (ft.Method == "" || ft.Method == method) && (ft.Path == "" || ft.Path == path) {
+			active := *ft
+			if ft.Times > 0 {
+				ft.Times--
+				if ft.Times == 0 {
+					f.faults = append(f.faults[:i], f.faults[i+1:]...)
+				}
+			}
+			return &active
+		}
+	}
+	return nil
+}
+
+func (f *faultInjector) list(c *gin.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	faults := []fault{}
+	for _, ft := range f.faults {
+		faults = append(faults, *ft)
+	}
+	c.JSON(http.StatusOK, faults)
+}
+
+func (f *faultInjector) add(c *gin.Context) {
+	var ft fault
+	if err := c.ShouldBindJSON(&ft); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	f.mu.Lock()
+	f.faults = append(f.faults, &ft)
+	f.mu.Unlock()
+
+	c.JSON(http.StatusCreated, ft)
+}
+
+func (f *faultInjector) clear(c *gin.Context) {
+	f.mu.Lock()
+	f.faults = nil
+	f.mu.Unlock()
+
+	c.Status(http.StatusNoContent)
+}
+
+// faultyStore fails store calls of requests the faultInjector marked.
+type faultyStore struct {
+	ItemStore
+}
+
+func (s faultyStore) check(ctx context.Context) error {
+	if ctx.Value(dbFaultKey{}) != nil {
+		return errInjectedFault
+	}
+	return nil
+}
+
+func (s faultyStore) ListItems(ctx context.Context) ([]Item, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	return s.ItemStore.ListItems(ctx)
+}
+
+func (s faultyStore) EachItem(ctx context.Context, fn func(Item) error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.ItemStore.EachItem(ctx, fn)
+}
+
+func (s faultyStore) GetItem(ctx context.Context, id int) (Item, error) {
+	if err := s.check(ctx); err != nil {
+		return Item{}, err
+	}
+	return s.ItemStore.GetItem(ctx, id)
+}
+
+func (s faultyStore) GetItems(ctx context.Context, ids []int) ([]Item, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	return s.ItemStore.GetItems(ctx, ids)
+}
+
+func (s faultyStore) EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.ItemStore.EachTaggedItem(ctx, tags, fn)
+}
+
+func (s faultyStore) TagItem(ctx context.Context, id int, tag string) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.ItemStore.TagItem(ctx, id, tag)
+}
+
+func (s faultyStore) UntagItem(ctx context.Context, id int, tag string) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.ItemStore.UntagItem(ctx, id, tag)
+}
+
+func (s faultyStore) CreateItem(ctx context.Context, item Item) (Item, error) {
+	if err := s.check(ctx); err != nil {
+		return Item{}, err
+	}
+	return s.ItemStore.CreateItem(ctx, item)
+}
+
+func (s faultyStore) UpdateItem(ctx context.Context, id int, item Item) (Item, error) {
+	if err := s.check(ctx); err != nil {
+		return Item{}, err
+	}
+	return s.ItemStore.UpdateItem(ctx, id, item)
+}
+
+func (s faultyStore) DeleteItem(ctx context.Context, id int) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.ItemStore.DeleteItem(ctx, id)
+}
+
+func (s faultyStore) ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (Reservation, error) {
+	if err := s.check(ctx); err != nil {
+		return Reservation{}, err
+	}
+	return s.ItemStore.ReserveItem(ctx, id, quantity, expiresAt)
+}
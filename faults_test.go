@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// injectFault makes the app fail matching requests until the test ends.
+// Tests using it must not run in parallel: faults apply to every client.
+func injectFault(t *testing.T, f fault) {
+	t.Helper()
+	requireTestEndpoint(t, "/_test/faults")
+	client.Request(t, http.MethodPost, "/_test/faults", f, http.StatusCreated, nil)
+	t.Cleanup(func() {
+		client.Request(t, http.MethodDelete, "/_test/faults", nil, http.StatusNoContent, nil)
+	})
+}
+
+// requireTestEndpoint skips the test when the app of a compose file runs
+// without the test endpoint at path, see WithComposeFile.
+func requireTestEndpoint(t *testing.T, path string) {
+	t.Helper()
+	if localTestContainer == nil || localTestContainer.composeProject == "" {
+		return
+	}
+	if status, _ := client.Do(t, http.MethodGet, path, nil); status == http.StatusNotFound {
+		t.Skipf("the compose file's app has no %s, pass GOPOS_FAULT_INJECTION and GOPOS_FAKE_CLOCK through", path)
+	}
+}
+
+func TestInjectedDBError(t *testing.T) {
+	item := factory.Item(t)
+	injectFault(t, fault{Method: http.MethodGet, Path: "/items/:id", DBError: true, Times: 1})
+
+	var body map[string]string
+	client.Request(t, http.MethodGet, fmt.Sprintf("/items/%d", item.ID), nil, http.StatusInternalServerError, &body)
+	assert.Equal(t, errInjectedFault.Error(), body["error"])
+
+	// The fault was used up.
+	client.GetItem(t, item.ID)
+}
+
+func TestInjectedStatus(t *testing.T) {
+	injectFault(t, fault{Method: http.MethodPost, Path: "/items", Status: http.StatusServiceUnavailable})
+
+	client.Request(t, http.MethodPost, "/items", Item{Name: "TestInjectedStatus", Price: 1}, http.StatusServiceUnavailable, nil)
+}
+
+func TestInjectedLatency(t *testing.T) {
+	injectFault(t, fault{Path: "/health", LatencyMs: 200, Times: 1})
+
+	start := time.Now()
+	client.Request(t, http.MethodGet, "/health", nil, http.StatusOK, nil)
+
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func FuzzCreateItem(f *testing.F) {
+	f.Add([]byte(`{"name":"Testitem","price":201}`))
+	f.Add([]byte(`{"name":"","price":-1}`))
+	f.Add([]byte(`{"price":99999999999999999999}`))
+	f.Add([]byte(`"not an item"`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`{`))
+
+	router := newMemRouter()
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated && w.Code != http.StatusBadRequest {
+			t.Fatalf("POST /items with %q: unexpected status %d: %s", body, w.Code, w.Body)
+		}
+	})
+}
+
+func FuzzUpdateItem(f *testing.F) {
+	f.Add("1", []byte(`{"name":"UpdatedItem","price":400}`))
+	f.Add("0", []byte(`{}`))
+	f.Add("-1", []byte(`null`))
+	f.Add("abc", []byte(`{"name":1}`))
+	f.Add("99999999999", []byte(`{"name":"x"}`))
+
+	router := newMemRouter()
+	seed := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(`{"name":"seed","price":1}`))
+	router.ServeHTTP(httptest.NewRecorder(), seed)
+
+	f.Fuzz(func(t *testing.T, id string, body []byte) {
+		req := httptest.NewRequest(http.MethodPut, "/items/"+url.PathEscape(id), bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code >= http.StatusInternalServerError {
+			t.Fatalf("PUT /items/%s with %q: unexpected status %d: %s", id, body, w.Code, w.Body)
+		}
+	})
+}
+
+func FuzzItemPath(f *testing.F) {
+	f.Add("1")
+	f.Add("0")
+	f.Add("-2147483649")
+	f.Add("1e3")
+	f.Add("%00")
+
+	router := newMemRouter()
+	f.Fuzz(func(t *testing.T, id string) {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			req := httptest.NewRequest(method, "/items/"+url.PathEscape(id), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code >= http.StatusInternalServerError {
+				t.Fatalf("%s /items/%s: unexpected status %d: %s", method, id, w.Code, w.Body)
+			}
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current responses")
+
+func TestGoldenCreateItem(t *testing.T) {
+	t.Parallel()
+
+	status, body := client.Do(t, http.MethodPost, "/items", Item{Name: "Golden", Price: 123})
+	var created Item
+	json.Unmarshal(body, &created)
+	t.Cleanup(func() {
+		client.DeleteItem(t, created.ID)
+	})
+
+	assertGolden(t, "create_item", status, body)
+}
+
+func TestGoldenGetItem(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t, withName("Golden"), withPrice(321), withStock(7))
+	status, body := client.Do(t, http.MethodGet, fmt.Sprintf("/items/%d", item.ID), nil)
+
+	assertGolden(t, "get_item", status, body)
+}
+
+func TestGoldenGetMissingItem(t *testing.T) {
+	t.Parallel()
+
+	status, body := client.Do(t, http.MethodGet, "/items/0", nil)
+
+	assertGolden(t, "get_missing_item", status, body)
+}
+
+func TestGoldenCreateItemInvalidBody(t *testing.T) {
+	t.Parallel()
+
+	status, body := client.Do(t, http.MethodPost, "/items", "not an item")
+
+	assertGolden(t, "create_item_invalid_body", status, body)
+}
+
+// assertGolden compares a response with testdata/golden/<name>.json after
+// normalizing values that change between runs. Run the tests with -update to
+// rewrite the golden files.
+func assertGolden(t *testing.T, name string, status int, body []byte) {
+	t.Helper()
+
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Response is not JSON: %q", body)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(map[string]any{
+		"status": status,
+		"body":   normalizeGolden(decoded),
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode response: %v", err)
+	}
+	actual := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	assert.Equal(t, string(expected), string(actual))
+}
+
+// normalizeGolden replaces generated ids so responses compare across runs.
+func normalizeGolden(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if k == "id" {
+				v[k] = "<id>"
+			} else {
+				v[k] = normalizeGolden(val)
+			}
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = normalizeGolden(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// halMediaType is the opt-in hypermedia format. Clients asking for it in
+// Accept get resources with _links to navigate the API.
+const halMediaType = "application/hal+json"
+
+type halLink struct {
+	Href string `json:"href"`
+}
+
+type halItem struct {
+	Item
+	Links struct {
+		Self       halLink `json:"self"`
+		Collection halLink `json:"collection"`
+	} `json:"_links"`
+}
+
+func newHALItem(item Item) halItem {
+	h := halItem{Item: item}
+	h.Links.Self = halLink{fmt.Sprintf("/items/%d", item.ID)}
+	h.Links.Collection = halLink{"/items"}
+	return h
+}
+
+// listFormat is how getItems frames the streamed items. open starts the
+// list found at self, the request URI.
+type listFormat struct {
+	contentType string
+	open        func(self string) string
+	close       string
+	encode      func(Item) ([]byte, error)
+}
+
+var (
+	jsonList = listFormat{
+		contentType: "application/json; charset=utf-8",
+		open:        func(string) string { return "[" },
+		close:       "]",
+		encode: func(item Item) ([]byte, error) {
+			return json.Marshal(item)
+		},
+	}
+	halList = listFormat{
+		contentType: halMediaType,
+		open: func(self string) string {
+			href, _ := json.Marshal(self)
+			return `{"_links":{"self":{"href":` + string(href) + `}},"_embedded":{"items":[`
+		},
+		close: "]}}",
+		encode: func(item Item) ([]byte, error) {
+			return json.Marshal(newHALItem(item))
+		},
+	}
+)
+
+// wantsHAL reports whether the client prefers HAL over plain JSON.
+func wantsHAL(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, halMediaType) == halMediaType
+}
+
+// renderItem responds with item in the format the client asked for.
+func renderItem(c *gin.Context, status int, item Item) {
+	if !wantsHAL(c) {
+		c.JSON(status, item)
+		return
+	}
+	data, err := json.Marshal(newHALItem(item))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(status, halMediaType, data)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHALItem(t *testing.T) {
+	router := newMemRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"TestHALItem","price":5}`))
+	req.Header.Set("Accept", halMediaType)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, halMediaType, w.Header().Get("Content-Type"))
+	var item halItem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+	assert.Equal(t, "TestHALItem", item.Name)
+	assert.Equal(t, fmt.Sprintf("/items/%d", item.ID), item.Links.Self.Href)
+	assert.Equal(t, "/items", item.Links.Collection.Href)
+
+	// Without asking for HAL, clients get plain JSON.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, item.Links.Self.Href, nil))
+	assert.Equal(t, fmt.Sprintf(`{"id":%d,"name":"TestHALItem","price":5,"stock":0}`, item.ID), w.Body.String())
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+}
+
+func TestHALUpdate(t *testing.T) {
+	update := func(t *testing.T, router http.Handler) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"TestHALUpdate","price":5}`)))
+		var created Item
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/items/%d", created.ID), strings.NewReader(`{"name":"Updated","price":6}`))
+		req.Header.Set("Accept", halMediaType)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var item halItem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+		assert.Equal(t, created.ID, item.ID)
+		assert.Equal(t, fmt.Sprintf("/items/%d", created.ID), item.Links.Self.Href)
+	}
+	t.Run("memory", func(t *testing.T) {
+		update(t, newMemRouter())
+	})
+	t.Run("sql", func(t *testing.T) {
+		db, _ := requireIsolatedDB(t)
+		update(t, newStoreRouter(newSQLItemStore(db)))
+	})
+}
+
+func TestHALList(t *testing.T) {
+	router := newMemRouter()
+	for _, name := range []string{"first", "second"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"`+name+`","price":1}`)))
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Accept", "application/hal+json, application/json;q=0.5")
+	router.ServeHTTP(w, req)
+
+	var list struct {
+		Links struct {
+			Self halLink `json:"self"`
+		} `json:"_links"`
+		Embedded struct {
+			Items []halItem `json:"items"`
+		} `json:"_embedded"`
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list), w.Body.String())
+	assert.Equal(t, "/items", list.Links.Self.Href)
+	if assert.Len(t, list.Embedded.Items, 2) {
+		assert.Equal(t, "second", list.Embedded.Items[1].Name)
+		assert.Equal(t, "/items/2", list.Embedded.Items[1].Links.Self.Href)
+	}
+}
+
+func TestHALListSelfLinkKeepsQuery(t *testing.T) {
+	router := newMemRouter()
+	for _, name := range []string{"first", "second"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"`+name+`","price":1}`)))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/items/2/tags/sale", nil))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/items?tag=sale", nil)
+	req.Header.Set("Accept", halMediaType)
+	router.ServeHTTP(w, req)
+
+	var list struct {
+		Links struct {
+			Self halLink `json:"self"`
+		} `json:"_links"`
+		Embedded struct {
+			Items []halItem `json:"items"`
+		} `json:"_embedded"`
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list), w.Body.String())
+	assert.Equal(t, "/items?tag=sale", list.Links.Self.Href)
+	if assert.Len(t, list.Embedded.Items, 1) {
+		assert.Equal(t, "second", list.Embedded.Items[0].Name)
+	}
+
+	// So does an empty result.
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/items?tag=organic", nil)
+	req.Header.Set("Accept", halMediaType)
+	router.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"_links":{"self":{"href":"/items?tag=organic"}},"_embedded":{"items":[]}}`, w.Body.String())
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// appImageTag returns the tag of the app image built from build: a hash of
+// the files of the build context and the build settings, so every test
+// package building the same sources shares one image. What .dockerignore
+// excludes isn't part of it, except the Dockerfile and .dockerignore, which
+// the build always gets.
+func appImageTag(build *dockertest.BuildOptions) (string, error) {
+	ignore, err := dockerignore(build.ContextDir)
+	if err != nil {
+		return "", err
+	}
+	ignored := func(rel string) bool {
+		rel = filepath.ToSlash(rel)
+		return rel != ".dockerignore" && rel != path.Clean(filepath.ToSlash(build.Dockerfile)) && ignore.excludes(rel)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "dockerfile=%s\nplatform=%s\n", build.Dockerfile, build.Platform)
+	for _, arg := range build.BuildArgs {
+		fmt.Fprintf(h, "arg %s=%s\n", arg.Name, arg.Value)
+	}
+	err = filepath.WalkDir(build.ContextDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(build.ContextDir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// An exception may bring back files of an excluded
+			// directory, so only skip it when there is none.
+			if rel != "." && !ignore.exceptions && ignored(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignored(rel) {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "file %s\n", filepath.ToSlash(rel))
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not hash the build context: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// ignoreRules are the rules of a .dockerignore, matched the way the Docker
+// builder does: * and ? don't cross a /, ** matches any number of
+// directories, a pattern excluding a directory excludes what is inside, a
+// leading ! makes a pattern an exception and the last matching pattern wins.
+type ignoreRules struct {
+	patterns []ignorePattern
+	// exceptions is whether any pattern starts with !.
+	exceptions bool
+}
+
+type ignorePattern struct {
+	re        *regexp.Regexp
+	exception bool
+}
+
+// dockerignore reads the .dockerignore of the build context dir.
+func dockerignore(dir string) (*ignoreRules, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ignoreRules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDockerignore(string(data))
+}
+
+func parseDockerignore(data string) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.exception = true
+			rules.exceptions = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(path.Clean(filepath.ToSlash(line)), "/")
+		if line == "" || line == "." {
+			continue
+		}
+		re, err := ignoreRegexp(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %w", line, err)
+		}
+		p.re = re
+		rules.patterns = append(rules.patterns, p)
+	}
+	return rules, nil
+}
+
+// ignoreRegexp translates a .dockerignore pattern to a regular expression.
+func ignoreRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(pattern) {
+					b.WriteString(".*")
+				} else {
+					b.WriteString("(.*/)?")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[', ']', '^', '-':
+			b.WriteByte(c)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// excludes reports whether the rules keep the slash separated path rel,
+// relative to the build context, out of the build.
+func (r *ignoreRules) excludes(rel string) bool {
+	excluded := false
+	for _, p := range r.patterns {
+		if p.matches(rel) {
+			excluded = !p.exception
+		}
+	}
+	return excluded
+}
+
+// matches reports whether the pattern matches rel or one of its parent
+// directories.
+func (p ignorePattern) matches(rel string) bool {
+	for {
+		if p.re.MatchString(rel) {
+			return true
+		}
+		i := strings.LastIndexByte(rel, '/')
+		if i < 0 {
+			return false
+		}
+		rel = rel[:i]
+	}
+}
+
+// lockBuild keeps test packages running at the same time from building the
+// same image twice: it waits until no other build of tag runs on this
+// machine and returns the function ending this one. A lock older than stale
+// is left over from a crashed build and taken over.
+func lockBuild(ctx context.Context, tag string, stale time.Duration) (func(), error) {
+	path := filepath.Join(os.TempDir(), "gopos-app-"+tag+".lock")
+	logged := false
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stale {
+			os.Remove(path)
+			continue
+		}
+		if !logged {
+			log.Printf("Waiting for another test package building app:%s", tag)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// imageExists reports whether the daemon has the image.
+func imageExists(pool *dockertest.Pool, image string) bool {
+	_, err := pool.Client.InspectImage(image)
+	return err == nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppImageTag(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("Dockerfile", "FROM golang:1.22")
+	write("main.go", "package main")
+	write(".dockerignore", "# built locally\n.git\nbin/\n**/*.log\n!keep.log\nDockerfile\n")
+	build := &dockertest.BuildOptions{Dockerfile: "Dockerfile", ContextDir: dir, Platform: "linux/amd64"}
+	tag := func() string {
+		t.Helper()
+		tag, err := appImageTag(build)
+		assert.NoError(t, err)
+		return tag
+	}
+	first := tag()
+	assert.Len(t, first, 12)
+
+	// Files the build doesn't see don't change the tag.
+	write("bin/gopos", "binary")
+	write("test.log", "log")
+	write("testdata/logs/app.log", "log")
+	write(".git/HEAD", "ref: refs/heads/master")
+	assert.Equal(t, first, tag())
+
+	// Hidden files the build sees, exceptions and the Dockerfile do.
+	write(".env", "GOPOS_PORT=8000")
+	withEnv := tag()
+	assert.NotEqual(t, first, withEnv)
+	write("keep.log", "log")
+	withLog := tag()
+	assert.NotEqual(t, withEnv, withLog)
+	write("Dockerfile", "FROM golang:1.23")
+	assert.NotEqual(t, withLog, tag())
+
+	write("main.go", "package main // changed")
+	changed := tag()
+	assert.NotEqual(t, first, changed)
+
+	build.BuildArgs = []docker.BuildArg{{Name: "RACE", Value: "true"}}
+	assert.NotEqual(t, changed, tag())
+}
+
+func TestDockerignore(t *testing.T) {
+	rules, err := parseDockerignore("# comment\n/bin\n*.tmp\ndocs/**/*.md\n!docs/README.md\nvendor/*\n!vendor/keep\n**/secret?.txt\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{"bin", true},
+		{"bin/gopos", true},
+		{"cmd/bin/gopos", false},
+		{"a.tmp", true},
+		{"dir/a.tmp", false},
+		{"docs/guide.md", true},
+		{"docs/api/v1/items.md", true},
+		{"docs/README.md", false},
+		{"vendor/lib/lib.go", true},
+		{"vendor/keep", false},
+		{"vendor/keep/file.go", false},
+		{"secret1.txt", true},
+		{"config/secret2.txt", true},
+		{"config/secret10.txt", false},
+		{".env", false},
+		{"main.go", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.excluded, rules.excludes(tt.path), tt.path)
+	}
+	assert.True(t, rules.exceptions)
+
+	_, err = parseDockerignore("[")
+	assert.Error(t, err)
+}
+
+func TestLockBuild(t *testing.T) {
+	tag := "test-" + newRunID()
+	unlock, err := lockBuild(context.Background(), tag, time.Minute)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = lockBuild(ctx, tag, time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlock()
+	unlock, err = lockBuild(context.Background(), tag, time.Minute)
+	assert.NoError(t, err)
+
+	// A crashed build's lock is taken over once stale.
+	unlock, err = lockBuild(context.Background(), tag, 0)
+	assert.NoError(t, err)
+	unlock()
+}
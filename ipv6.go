@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+)
+
+// CheckIPv6 verifies that the app answers /health on its IPv6 address on
+// the test network. It needs an environment created WithIPv6Network.
+func (l LocalTestContainer) CheckIPv6() error {
+	if !l.ipv6 {
+		return errors.New("the test network has no IPv6, see WithIPv6Network")
+	}
+	container, err := l.pool.Client.InspectContainer(l.appcontainer.Container.ID)
+	if err != nil {
+		return err
+	}
+
+	var addr string
+	for _, endpoint := range container.NetworkSettings.Networks {
+		if endpoint.NetworkID == l.network && endpoint.GlobalIPv6Address != "" {
+			addr = endpoint.GlobalIPv6Address
+		}
+	}
+	if addr == "" {
+		return errors.New("the app container has no IPv6 address on the test network")
+	}
+
+	var out bytes.Buffer
+	exitCode, err := l.appcontainer.Exec([]string{"curl", "-fsS", "-g", fmt.Sprintf("http://[%s]:8000/health", addr)}, dockertest.ExecOptions{
+		StdOut: &out,
+		StdErr: &out,
+	})
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("the app did not answer on [%s]:8000: %s", addr, out.String())
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestServesIPv6(t *testing.T) {
+	requireIntegration(t)
+	if !localTestContainer.ipv6 {
+		t.Skip("set TEST_IPV6=1 to run the environment on an IPv6 network")
+	}
+
+	if err := localTestContainer.CheckIPv6(); err != nil {
+		t.Fatal(err)
+	}
+}
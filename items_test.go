@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateItem(t *testing.T) {
+	t.Parallel()
+
+	createdItem := client.CreateItem(t, Item{
+		Name:  "Testitem",
+		Price: 201,
+	})
+	t.Cleanup(func() {
+		client.DeleteItem(t, createdItem.ID)
+	})
+
+	// Test retrieving the created item
+	fetchedItem := client.GetItem(t, createdItem.ID)
+
+	assert.Equal(t, createdItem.Name, fetchedItem.Name)
+	assert.Equal(t, createdItem.Price, fetchedItem.Price)
+}
+
+func TestGetItem(t *testing.T) {
+	t.Parallel()
+
+	// Create an item to test retrieval
+	createdItem := factory.Item(t, withName("TestGetItem"), withPrice(200))
+
+	// Test retrieving the created item
+	fetchedItem := client.GetItem(t, createdItem.ID)
+
+	assert.Equal(t, createdItem.Name, fetchedItem.Name)
+	assert.Equal(t, createdItem.Price, fetchedItem.Price)
+}
+
+func TestUpdateItem(t *testing.T) {
+	t.Parallel()
+
+	// Create an item to test updating
+	createdItem := factory.Item(t)
+
+	// Test updating the created item
+	updateItem := Item{
+		Name:  "UpdatedItem",
+		Price: 400,
+	}
+	updatedItem := client.UpdateItem(t, createdItem.ID, updateItem)
+
+	assert.Equal(t, createdItem.ID, updatedItem.ID)
+	assert.Equal(t, updateItem.Name, updatedItem.Name)
+	assert.Equal(t, updateItem.Price, updatedItem.Price)
+}
+
+func TestDeleteItem(t *testing.T) {
+	t.Parallel()
+
+	// Create an item to test deletion
+	createdItem := factory.Item(t)
+
+	// Test deleting the created item
+	client.DeleteItem(t, createdItem.ID)
+
+	// Verify item deletion
+	client.Request(t, http.MethodGet, fmt.Sprintf("/items/%d", createdItem.ID), nil, http.StatusNotFound, nil)
+}
+
+func TestGetItemsByID(t *testing.T) {
+	t.Parallel()
+
+	first := factory.Item(t)
+	second := factory.Item(t)
+	deleted := factory.Item(t)
+	client.DeleteItem(t, deleted.ID)
+
+	var body struct {
+		Items   []Item `json:"items"`
+		Missing []int  `json:"missing"`
+	}
+	path := fmt.Sprintf("/items?ids=%d,%d,%d,%d", second.ID, deleted.ID, first.ID, second.ID)
+	client.Request(t, http.MethodGet, path, nil, http.StatusOK, &body)
+
+	assert.Equal(t, []Item{second, first}, body.Items)
+	assert.Equal(t, []int{deleted.ID}, body.Missing)
+
+	client.Request(t, http.MethodGet, "/items?ids=1,abc", nil, http.StatusBadRequest, nil)
+	client.Request(t, http.MethodGet, "/items?ids="+strings.Repeat("1,", maxBatchIDs)+"2", nil, http.StatusBadRequest, nil)
+}
+
+// failingListStore fails after listing its first item.
+type failingListStore struct {
+	*memItemStore
+}
+
+func (s failingListStore) EachItem(ctx context.Context, fn func(Item) error) error {
+	if err := fn(Item{ID: 1, Name: "first", Price: 1}); err != nil {
+		return err
+	}
+	return errors.New("connection lost")
+}
+
+func TestGetItemsStreamError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := &GoPOS{store: failingListStore{newMemItemStore()}}
+	router := gin.New()
+	g.registerRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	// The status was already sent with the first item; the truncated body
+	// must not parse as a complete list.
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `[{"id":1,"name":"first","price":1,"stock":0}`, w.Body.String())
+	assert.False(t, json.Valid(w.Body.Bytes()))
+}
+
+func TestCacheControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	g := &GoPOS{store: newMemItemStore(), cacheMaxAge: 30 * time.Second}
+	g.registerRoutes(router)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		want   string
+	}{
+		{http.MethodGet, "/items", "", "private, max-age=30"},
+		{http.MethodGet, "/items/1", "", "private, max-age=30"},
+		{http.MethodPost, "/items", `{"name":"TestCacheControl","price":1}`, "no-store"},
+		{http.MethodPut, "/items/1", `{"name":"TestCacheControl","price":2}`, "no-store"},
+		{http.MethodDelete, "/items/1", "", "no-store"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		assert.Equal(t, tc.want, w.Header().Get("Cache-Control"), "%s %s", tc.method, tc.path)
+	}
+
+	g.cacheMaxAge = 0
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net"
+	"strconv"
+)
+
+const kafkaImage = "docker.redpanda.com/redpandadata/redpanda:v24.1.7"
+
+// WithKafka starts a single-broker Kafka (Redpanda) on the test network,
+// creates topics and points the app at it with GOPOS_KAFKA_BROKERS. Use
+// KafkaBrokers to reach it from the tests.
+func WithKafka(topics ...string) Option {
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:   "kafka",
+			image:  kafkaImage,
+			appEnv: []string{"GOPOS_KAFKA_BROKERS=kafka:9092"},
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return createKafka(ctx, pool, network, o, host, topics)
+			},
+		})
+	}
+}
+
+// createKafka starts the broker and waits until it is healthy. Brokers
+// hand clients the address to connect to, so the broker advertises its
+// alias on the test network and a fixed host port to the tests, which must
+// be known before it starts. With a remote docker host, the port is only
+// likely to be free there.
+func createKafka(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, topics []string) (*dockertest.Resource, error) {
+	hostPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	resource, err := startService(ctx, pool, network, o, host, "kafka", ServiceSpec{
+		Image: kafkaImage,
+		Command: []string{"redpanda", "start", "--mode", "dev-container", "--smp", "1",
+			"--kafka-addr", "internal://0.0.0.0:9092,external://0.0.0.0:19092",
+			"--advertise-kafka-addr", fmt.Sprintf("internal://kafka:9092,external://%s", net.JoinHostPort(host, strconv.Itoa(hostPort)))},
+		Ports: []string{fmt.Sprintf("%d:19092", hostPort)},
+		waits: []WaitStrategy{WaitForExec("rpk", "cluster", "health", "--exit-when-healthy")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) > 0 {
+		if err := execOK(resource, append([]string{"rpk", "topic", "create"}, topics...)...); err != nil {
+			resource.Close()
+			return nil, fmt.Errorf("could not create kafka topics: %w", err)
+		}
+	}
+	return resource, nil
+}
+
+// KafkaBrokers returns the addresses the tests reach the WithKafka broker
+// at.
+func (l LocalTestContainer) KafkaBrokers() ([]string, error) {
+	addr, err := l.ServiceAddr("kafka", "19092")
+	if err != nil {
+		return nil, err
+	}
+	return []string{addr}, nil
+}
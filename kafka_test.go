@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// requireKafka skips tests needing the WithKafka broker unless the
+// environment runs it.
+func requireKafka(t *testing.T) []string {
+	t.Helper()
+	requireIntegration(t)
+	if !localTestContainer.hasService("kafka") {
+		t.Skip("set TEST_KAFKA=1 to run Kafka next to the app")
+	}
+	brokers, err := localTestContainer.KafkaBrokers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return brokers
+}
+
+func TestItemEvents(t *testing.T) {
+	brokers := requireKafka(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Only events published from here on, in case earlier tests wrote items.
+	conn, err := kafka.DialLeader(ctx, "tcp", brokers[0], "item-events", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := conn.ReadLastOffset()
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: "item-events", MaxWait: 100 * time.Millisecond})
+	defer reader.Close()
+	if err := reader.SetOffset(last); err != nil {
+		t.Fatal(err)
+	}
+
+	item := client.CreateItem(t, Item{Name: "TestItemEvents", Price: 1, Stock: 1})
+	t.Cleanup(func() { client.DeleteItem(t, item.ID) })
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			t.Fatalf("No created event of item %d: %v", item.ID, err)
+		}
+		var event itemEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type == "created" && event.Item.ID == item.ID {
+			assert.Equal(t, item, event.Item)
+			return
+		}
+	}
+}
+
+func TestConsumeStockAdjustmentsKafka(t *testing.T) {
+	brokers := requireKafka(t)
+	db := requireTestDB(t)
+	store := newSQLItemStore(db)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	item, err := store.CreateItem(ctx, Item{Name: "TestConsumeStockAdjustmentsKafka", Price: 1, Stock: 1})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(context.Background(), item.ID)
+	})
+
+	writer := &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: "stock-adjustments", BatchTimeout: 10 * time.Millisecond}
+	defer writer.Close()
+	produce := func(adjs ...stockAdjustment) {
+		t.Helper()
+		var msgs []kafka.Message
+		for _, adj := range adjs {
+			msgs = append(msgs, stockMessage(t, 0, adj))
+		}
+		if err := writer.WriteMessages(ctx, msgs...); err != nil {
+			t.Fatalf("Failed to produce: %v", err)
+		}
+	}
+	// consume runs the worker in a consumer group of its own, which starts
+	// from the first message of the topic, until the item has stock.
+	consume := func(group string, stock int) {
+		t.Helper()
+		reader := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: "stock-adjustments", GroupID: group, MaxWait: 100 * time.Millisecond})
+		defer reader.Close()
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			done <- consumeStockAdjustments(ctx, reader, store)
+		}()
+		assert.Eventually(t, func() bool {
+			fetched, err := store.GetItem(ctx, item.ID)
+			return err == nil && fetched.Stock == stock
+		}, 30*time.Second, 50*time.Millisecond)
+		cancel()
+		assert.NoError(t, <-done)
+	}
+
+	prefix := fmt.Sprintf("%d-", rand.Int63())
+	produce(
+		stockAdjustment{EventID: prefix + "1", ItemID: item.ID, Delta: 5},
+		stockAdjustment{EventID: prefix + "1", ItemID: item.ID, Delta: 5},
+		stockAdjustment{EventID: prefix + "2", ItemID: item.ID, Delta: -2},
+	)
+	// 1 + 5 - 2: the duplicate event counts once.
+	consume(prefix+"a", 4)
+
+	// Another group gets every message again, as after a crash before the
+	// commit. Only the new event changes the stock; once it is applied, the
+	// redelivered ones before it were skipped.
+	produce(stockAdjustment{EventID: prefix + "3", ItemID: item.ID, Delta: 1})
+	consume(prefix+"b", 5)
+
+	var processed int
+	err = db.QueryRowContext(ctx, "SELECT count(*) FROM processed_events WHERE event_id LIKE $1", prefix+"%").Scan(&processed)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, processed)
+}
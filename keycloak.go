@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"os"
+)
+
+const keycloakImage = "quay.io/keycloak/keycloak:24.0.5"
+
+// keycloakImportDir is where Keycloak imports realms from at start.
+const keycloakImportDir = "/opt/keycloak/data/import"
+
+// keycloakRealm is what the tests need to know of the imported realm.
+type keycloakRealm struct {
+	Realm   string `json:"realm"`
+	Clients []struct {
+		ClientID string `json:"clientId"`
+		Secret   string `json:"secret"`
+	} `json:"clients"`
+}
+
+// client returns the first client of the realm with a secret, the one the
+// tests get tokens for.
+func (r keycloakRealm) client() (string, string) {
+	for _, c := range r.Clients {
+		if c.Secret != "" {
+			return c.ClientID, c.Secret
+		}
+	}
+	return "", ""
+}
+
+// WithKeycloak starts a Keycloak on the test network with the realm of the
+// exported realm JSON realmFile imported, and points the app at it with
+// OIDC_ISSUER_URL and OIDC_CLIENT_ID. Use KeycloakTokenURL and
+// KeycloakClient to get tokens from the tests.
+//
+// Keycloak names itself http://keycloak:8080 in the tokens it issues
+// whoever asks, so tokens the tests get are valid for the app.
+func WithKeycloak(realmFile string) Option {
+	return func(o *options) {
+		data, err := os.ReadFile(realmFile)
+		if err == nil {
+			err = json.Unmarshal(data, &o.keycloakRealm)
+		}
+		if err != nil {
+			o.errs = append(o.errs, fmt.Errorf("keycloak realm %s: %w", realmFile, err))
+			return
+		}
+		clientID, _ := o.keycloakRealm.client()
+		o.addSidecar(sidecar{
+			name:  "keycloak",
+			image: keycloakImage,
+			appEnv: []string{
+				"OIDC_ISSUER_URL=" + keycloakIssuer("keycloak:8080", o.keycloakRealm.Realm),
+				"OIDC_CLIENT_ID=" + clientID,
+			},
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return createKeycloak(ctx, pool, network, o, host, realmFile)
+			},
+		})
+	}
+}
+
+func keycloakIssuer(addr string, realm string) string {
+	return fmt.Sprintf("http://%s/realms/%s", addr, realm)
+}
+
+// createKeycloak starts Keycloak once the realm is uploaded and waits until
+// the realm is served.
+func createKeycloak(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, realmFile string) (*dockertest.Resource, error) {
+	resource, err := runService(pool, network, o, "keycloak", ServiceSpec{
+		Image: keycloakImage,
+		Env: map[string]string{
+			"KEYCLOAK_ADMIN":          "admin",
+			"KEYCLOAK_ADMIN_PASSWORD": "admin",
+			"KC_HOSTNAME_URL":         "http://keycloak:8080",
+			"KC_HEALTH_ENABLED":       "true",
+		},
+		Entrypoint: []string{"/bin/bash", "-c", waitForUpload(keycloakImportDir, "exec /opt/keycloak/bin/kc.sh start-dev --import-realm")},
+		Ports:      []string{"8080"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := uploadDir(pool, resource.Container.ID, realmFile, keycloakImportDir); err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("could not copy the keycloak realm: %w", err)
+	}
+	path := fmt.Sprintf("/realms/%s/.well-known/openid-configuration", o.keycloakRealm.Realm)
+	target := WaitTarget{Pool: pool, Resource: resource, Host: host}
+	if err := waitFor(ctx, target, o.container("keycloak").wait, WaitForHTTP("8080", path)); err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("keycloak didn't come up: %w", err)
+	}
+	return resource, nil
+}
+
+// KeycloakTokenURL returns the URL the tests get tokens of the WithKeycloak
+// realm from.
+func (l LocalTestContainer) KeycloakTokenURL() (string, error) {
+	addr, err := l.ServiceAddr("keycloak", "8080")
+	if err != nil {
+		return "", err
+	}
+	return keycloakIssuer(addr, l.keycloakRealm.Realm) + "/protocol/openid-connect/token", nil
+}
+
+// KeycloakIssuer returns the issuer of the tokens of the WithKeycloak realm,
+// as the app sees it.
+func (l LocalTestContainer) KeycloakIssuer() string {
+	return keycloakIssuer("keycloak:8080", l.keycloakRealm.Realm)
+}
+
+// KeycloakClient returns the ID and secret of the first confidential client
+// of the WithKeycloak realm.
+func (l LocalTestContainer) KeycloakClient() (clientID string, secret string) {
+	return l.keycloakRealm.client()
+}
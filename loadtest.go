@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// loadtestBuckets are the upper bounds of the latency histogram.
+var loadtestBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type loadtestResult struct {
+	latency time.Duration
+	failed  bool
+}
+
+func newLoadtestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "loadtest",
+		Short:        "Send a constant request rate at a running instance and check latency thresholds.",
+		SilenceUsage: true,
+		RunE:         loadtest,
+	}
+	cmd.Flags().String("target", "http://localhost:8000", "base url of the instance under test")
+	cmd.Flags().String("method", http.MethodGet, "request method")
+	cmd.Flags().String("path", "/items", "request path")
+	cmd.Flags().Int64("seed", 1, "seed for the generated item bodies of POST and PUT requests")
+	cmd.Flags().Int("rps", 50, "requests per second")
+	cmd.Flags().Duration("duration", 30*time.Second, "how long to send requests")
+	cmd.Flags().Int("max-in-flight", 200, "maximum number of concurrent requests")
+	cmd.Flags().Duration("max-p99", 500*time.Millisecond, "fail when the p99 latency exceeds this (0 disables)")
+	cmd.Flags().Float64("max-error-rate", 0.01, "fail when the ratio of failed requests exceeds this")
+	return cmd
+}
+
+func loadtest(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	target, _ := flags.GetString("target")
+	method, _ := flags.GetString("method")
+	path, _ := flags.GetString("path")
+	seed, _ := flags.GetInt64("seed")
+	rps, _ := flags.GetInt("rps")
+	duration, _ := flags.GetDuration("duration")
+	maxInFlight, _ := flags.GetInt("max-in-flight")
+	maxP99, _ := flags.GetDuration("max-p99")
+	maxErrorRate, _ := flags.GetFloat64("max-error-rate")
+	if rps <= 0 {
+		return fmt.Errorf("--rps must be positive")
+	}
+
+	url := strings.TrimSuffix(target, "/") + path
+	client := &http.Client{Timeout: 10 * time.Second}
+	withBody := method == http.MethodPost || method == http.MethodPut
+	var genMu sync.Mutex
+	gen := newDataGen(seed)
+
+	results := runLoad(rps, duration, maxInFlight, func() bool {
+		var body io.Reader
+		if withBody {
+			genMu.Lock()
+			item := gen.Item()
+			genMu.Unlock()
+			data, _ := json.Marshal(item)
+			body = bytes.NewReader(data)
+		}
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			return false
+		}
+		if withBody {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode < http.StatusBadRequest
+	})
+
+	return reportLoad(os.Stdout, results, maxP99, maxErrorRate)
+}
+
+// runLoad calls request rps times per second for duration, never running more
+// than maxInFlight requests at once, and waits for all of them to finish.
+func runLoad(rps int, duration time.Duration, maxInFlight int, request func() bool) []loadtestResult {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var results []loadtestResult
+	inFlight := make(chan struct{}, maxInFlight)
+
+	ticker := time.NewTicker(time.Second / time.Duration(rps))
+	defer ticker.Stop()
+	deadline := time.After(duration)
+
+	for {
+		select {
+		case <-deadline:
+			wg.Wait()
+			return results
+		case <-ticker.C:
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				// Saturated: count the dropped request as a failure rather
+				// than silently lowering the rate.
+				mu.Lock()
+				results = append(results, loadtestResult{failed: true})
+				mu.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				ok := request()
+				r := loadtestResult{latency: time.Since(start), failed: !ok}
+				<-inFlight
+
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}()
+		}
+	}
+}
+
+func reportLoad(out io.Writer, results []loadtestResult, maxP99 time.Duration, maxErrorRate float64) error {
+	if len(results) == 0 {
+		return fmt.Errorf("no requests were sent")
+	}
+
+	var latencies []time.Duration
+	failed := 0
+	for _, r := range results {
+		if r.failed {
+			failed++
+		} else {
+			latencies = append(latencies, r.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	errorRate := float64(failed) / float64(len(results))
+	p99 := quantile(latencies, 0.99)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "requests\t%d\n", len(results))
+	fmt.Fprintf(w, "errors\t%d (%.2f%%)\n", failed, errorRate*100)
+	for _, q := range []float64{0.5, 0.9, 0.95, 0.99} {
+		fmt.Fprintf(w, "p%.0f\t%s\n", q*100, quantile(latencies, q))
+	}
+	if len(latencies) > 0 {
+		fmt.Fprintf(w, "max\t%s\n", latencies[len(latencies)-1])
+	}
+	fmt.Fprintln(w)
+
+	counts := make([]int, len(loadtestBuckets)+1)
+	for _, l := range latencies {
+		i := sort.Search(len(loadtestBuckets), func(i int) bool { return l <= loadtestBuckets[i] })
+		counts[i]++
+	}
+	for i, c := range counts {
+		label := "+Inf"
+		if i < len(loadtestBuckets) {
+			label = "<= " + loadtestBuckets[i].String()
+		}
+		bar := 0
+		if len(latencies) > 0 {
+			bar = c * 50 / len(latencies)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", label, c, strings.Repeat("#", bar))
+	}
+	w.Flush()
+
+	var violations []string
+	if errorRate > maxErrorRate {
+		violations = append(violations, fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", errorRate*100, maxErrorRate*100))
+	}
+	if maxP99 > 0 && p99 > maxP99 {
+		violations = append(violations, fmt.Sprintf("p99 latency %s exceeds %s", p99, maxP99))
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("thresholds exceeded: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*q)]
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net/http"
+	"strings"
+)
+
+const localStackImage = "localstack/localstack:3.5"
+
+// WithLocalStack starts LocalStack on the test network emulating the given
+// AWS services, "sqs", "s3" and "ssm" when none are given, and points the
+// app's AWS SDK at it with AWS_ENDPOINT_URL, AWS_REGION and dummy
+// credentials. Use AWSEndpoint to reach it from the tests.
+func WithLocalStack(services ...string) Option {
+	if len(services) == 0 {
+		services = []string{"sqs", "s3", "ssm"}
+	}
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:  "localstack",
+			image: localStackImage,
+			appEnv: []string{
+				"AWS_ENDPOINT_URL=http://localstack:4566",
+				"AWS_REGION=us-east-1",
+				"AWS_ACCESS_KEY_ID=test",
+				"AWS_SECRET_ACCESS_KEY=test",
+			},
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return createLocalStack(ctx, pool, network, o, host, services)
+			},
+		})
+	}
+}
+
+// createLocalStack starts LocalStack and waits until its health endpoint
+// reports every service available.
+func createLocalStack(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, services []string) (*dockertest.Resource, error) {
+	return startService(ctx, pool, network, o, host, "localstack", ServiceSpec{
+		Image: localStackImage,
+		Env:   map[string]string{"SERVICES": strings.Join(services, ",")},
+		Ports: []string{"4566"},
+		waits: []WaitStrategy{WaitFunc(func(ctx context.Context, target WaitTarget) error {
+			addr, err := target.addr("4566")
+			if err != nil {
+				return err
+			}
+			return localStackHealthy(ctx, "http://"+addr+"/_localstack/health", services)
+		})},
+	})
+}
+
+// localStackHealthy checks LocalStack's health report. Services start
+// lazily, so "available" is as good as "running".
+func localStackHealthy(ctx context.Context, url string, services []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var health struct {
+		Services map[string]string `json:"services"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return err
+	}
+	for _, service := range services {
+		if state := health.Services[service]; state != "available" && state != "running" {
+			return fmt.Errorf("%s is %q", service, state)
+		}
+	}
+	return nil
+}
+
+// AWSEndpoint returns the URL the tests reach the WithLocalStack services
+// at. Any credentials are accepted.
+func (l LocalTestContainer) AWSEndpoint() (string, error) {
+	addr, err := l.ServiceAddr("localstack", "4566")
+	if err != nil {
+		return "", err
+	}
+	return "http://" + addr, nil
+}
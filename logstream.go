@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"sync"
+)
+
+// WithLogStream streams the output of the app build and the logs of the
+// db, migrate, app and sidecar containers to logf, a line at a time prefixed with
+// the container, e.g. t.Logf or log.Printf. The streams stop on Close.
+func WithLogStream(logf func(format string, args ...any)) Option {
+	return func(o *options) {
+		o.logf = logf
+	}
+}
+
+// logStreamer follows the logs of containers until stopped.
+type logStreamer struct {
+	logf   func(format string, args ...any)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newLogStreamer(logf func(format string, args ...any)) *logStreamer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &logStreamer{logf: logf, ctx: ctx, cancel: cancel}
+}
+
+// follow streams the logs of resource under name, from its start.
+func (s *logStreamer) follow(pool *dockertest.Pool, name string, resource *dockertest.Resource) {
+	if s == nil || s.logf == nil {
+		return
+	}
+	w := &prefixWriter{prefix: name, logf: s.logf}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer w.Flush()
+		pool.Client.Logs(docker.LogsOptions{
+			Context:      s.ctx,
+			Container:    resource.Container.ID,
+			OutputStream: w,
+			ErrorStream:  w,
+			Stdout:       true,
+			Stderr:       true,
+			Follow:       true,
+		})
+	}()
+}
+
+// stop ends the streams and waits for them, so nothing is logged after a
+// test has finished.
+func (s *logStreamer) stop() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// prefixWriter passes what is written to it to logf line by line.
+type prefixWriter struct {
+	mu     sync.Mutex
+	prefix string
+	logf   func(format string, args ...any)
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.logf("%s | %s", w.prefix, bytes.TrimRight(w.buf[:i], "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs what is left of an unterminated last line.
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.logf("%s | %s", w.prefix, w.buf)
+		w.buf = nil
+	}
+}
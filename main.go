@@ -1,30 +1,58 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"log"
+	"net"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
-const defaultport = "3000"
+const defaultport = "8000"
+
+// dbDriver is the database/sql driver name registered by pgx's stdlib
+// package.
+const dbDriver = "pgx"
 
 type Item struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
 	Price int    `json:"price"`
+	Stock int    `json:"stock" binding:"min=0"`
 }
 
 type GoPOS struct {
-	db   *sql.DB
-	port string
-	host string
+	db    *sql.DB
+	store ItemStore
+	port  string
+	host  string
+	// cacheMaxAge is how long clients may reuse item reads.
+	cacheMaxAge time.Duration
+	// slowQueryThreshold is how long a store call may take before it is
+	// logged as slow, zero disables the log.
+	slowQueryThreshold time.Duration
+	// middlewareChains names the middleware of each route group, see
+	// loadMiddleware.
+	middlewareChains map[string][]string
+	// clock is read instead of time.Now, see Clock.
+	clock Clock
 }
 
 func main() {
@@ -36,6 +64,10 @@ func main() {
 		Long:  `A simple golang app connects to postgresql`,
 		Run:   serve,
 	}
+	rootCmd.AddCommand(newDBCmd())
+	rootCmd.AddCommand(newLoadtestCmd())
+	rootCmd.AddCommand(newWorkerCmd())
+	rootCmd.AddCommand(newTestenvCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalf("error running command: %v", err)
@@ -45,9 +77,11 @@ func main() {
 
 func newGpos(db *sql.DB, port string, host string) *GoPOS {
 	return &GoPOS{
-		db:   db,
-		port: port,
-		host: host,
+		db:    db,
+		store: newSQLItemStore(db),
+		port:  port,
+		host:  host,
+		clock: systemClock{},
 	}
 }
 
@@ -56,51 +90,228 @@ func (g GoPOS) runMigration() {
 }
 
 func serve(cmd *cobra.Command, args []string) {
-	db, err := initDB()
+	db, store := initStore()
+
+	viper.SetDefault("GOPOS_PORT", defaultport)
+	viper.SetDefault("GOPOS_CACHE_MAX_AGE", "5s")
+	viper.SetDefault("GOPOS_RESERVATION_SWEEP", "30s")
+	viper.SetDefault("GOPOS_WEBHOOK_INTERVAL", "1s")
+	viper.SetDefault("GOPOS_ARCHIVE_INTERVAL", "1h")
+	viper.SetDefault("GOPOS_ARCHIVE_RETENTION", "720h")
+	viper.SetDefault("GOPOS_ARCHIVE_BATCH", 500)
+	viper.SetDefault("GOPOS_SLOW_QUERY_THRESHOLD", "500ms")
+	host := viper.GetString("GOPOS_HOST")
+	port := viper.GetString("GOPOS_PORT")
+	adminAddr := viper.GetString("GOPOS_ADMIN_ADDR")
+	viper.SetDefault("GOPOS_UNIX_SOCKET_MODE", "0660")
+	socket := viper.GetString("GOPOS_UNIX_SOCKET")
+	socketMode, err := strconv.ParseUint(viper.GetString("GOPOS_UNIX_SOCKET_MODE"), 8, 32)
 	if err != nil {
-		fmt.Println(err)
+		log.Fatalf("invalid GOPOS_UNIX_SOCKET_MODE: %s", err)
 	}
 
-	g := newGpos(db, "", "")
-	router := gin.Default()
-	router.GET("/health", g.getStatus)
-	router.GET("/items", g.getItems)
-	router.GET("/items/:id", g.getItem)
-	router.POST("/items", g.createItem)
-	router.PUT("/items/:id", g.updateItem)
-	router.DELETE("/items/:id", g.deleteItem)
-
-	wait := sync.WaitGroup{}
-	go func() {
-		err := router.Run(":8000")
-		if err != nil {
-			log.Println("Could not start http serving: ", err)
+	if viper.GetDuration("GOPOS_ARCHIVE_RETENTION") < 0 || viper.GetInt("GOPOS_ARCHIVE_BATCH") < 1 {
+		log.Fatal("invalid GOPOS_ARCHIVE_RETENTION or GOPOS_ARCHIVE_BATCH")
+	}
+
+	g := newGpos(db, port, host)
+	g.store = store
+	g.cacheMaxAge = viper.GetDuration("GOPOS_CACHE_MAX_AGE")
+	g.slowQueryThreshold = viper.GetDuration("GOPOS_SLOW_QUERY_THRESHOLD")
+	g.middlewareChains, err = loadMiddleware()
+	if err != nil {
+		log.Fatal(err)
+	}
+	activated, err := activationListeners()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if writer := g.enableEvents(); writer != nil {
+		defer writer.Close()
+	}
+	deliverer, err := g.enableWebhooks()
+	if err != nil {
+		log.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	g.enableMetrics(reg)
+	adminLn := adminListener(activated)
+	router, admin := g.newRouters(reg, adminAddr != "" || adminLn != nil)
+
+	reuse := viper.GetBool("GOPOS_REUSEPORT")
+
+	var servers []server
+	for _, l := range activated {
+		if l.name != "admin" {
+			servers = append(servers, server{name: l.name, ln: l.ln, handler: router})
 		}
-	}()
+	}
+	if len(servers) == 0 {
+		servers = append(servers, server{name: "api", addr: net.JoinHostPort(host, port), reusePort: reuse, handler: router})
+	}
+	if socket != "" {
+		servers = append(servers, server{name: "api", network: "unix", addr: socket, mode: os.FileMode(socketMode), handler: router})
+	}
+	if admin != nil {
+		servers = append(servers, server{name: "admin", addr: adminAddr, reusePort: reuse, ln: adminLn, handler: admin})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go expireReservations(ctx, g.store, g.clock, viper.GetDuration("GOPOS_RESERVATION_SWEEP"))
+	if deliverer != nil {
+		go deliverWebhooks(ctx, deliverer, viper.GetDuration("GOPOS_WEBHOOK_INTERVAL"))
+	}
+	if db != nil {
+		go archivePeriodically(ctx, db, g.clock, viper.GetDuration("GOPOS_ARCHIVE_INTERVAL"),
+			viper.GetDuration("GOPOS_ARCHIVE_RETENTION"), viper.GetInt("GOPOS_ARCHIVE_BATCH"))
+	}
+
+	if err := runServers(ctx, servers); err != nil {
+		log.Println("Could not start http serving: ", err)
+	}
+}
 
-	wait.Add(1)
-	wait.Wait()
+// newRouters returns the router of the API and, with separateAdmin, the
+// router of the admin listener; otherwise the API router serves the admin
+// endpoints too and admin is nil. The admin router also serves the item
+// reads, which the dashboard lists from its own origin.
+func (g *GoPOS) newRouters(reg *prometheus.Registry, separateAdmin bool) (router *gin.Engine, admin *gin.Engine) {
+	router = gin.New()
+	router.Use(g.middleware("api")...)
+	handleMethods(router)
+	if viper.GetBool("GOPOS_FAULT_INJECTION") {
+		log.Println("Fault injection enabled, do not use in production")
+		g.enableFaultInjection(router)
+	}
+	if viper.GetBool("GOPOS_FAKE_CLOCK") {
+		log.Println("Fake clock enabled, do not use in production")
+		g.enableFakeClock(router)
+	}
+	g.registerRoutes(router)
+
+	if !separateAdmin {
+		registerMetrics(router, reg)
+		g.registerAdmin(router)
+		return router, nil
+	}
+	admin = gin.New()
+	admin.Use(g.middleware("admin")...)
+	handleMethods(admin)
+	admin.GET("/health", g.getStatus)
+	admin.GET("/readyz", g.getReadiness)
+	registerMetrics(admin, reg)
+	g.registerAdmin(admin)
+	items := admin.Group("/items", g.middleware("items")...)
+	items.GET("", g.getItems)
+	items.HEAD("", g.getItems)
+	items.GET("/:id", g.getItem)
+	items.HEAD("/:id", g.getItem)
+	return router, admin
 }
 
+// enableFaultInjection installs the test-only fault injector. It must be
+// called before registerRoutes.
+func (g *GoPOS) enableFaultInjection(router *gin.Engine) {
+	injector := &faultInjector{}
+	injector.register(router)
+	g.store = faultyStore{g.store}
+}
+
+// registerRoutes mounts the API. Every GET route also answers HEAD, for
+// monitoring probes.
+func (g *GoPOS) registerRoutes(router gin.IRouter) {
+	router.GET("/health", g.getStatus)
+	router.HEAD("/health", g.getStatus)
+	router.GET("/readyz", g.getReadiness)
+	router.HEAD("/readyz", g.getReadiness)
+	items := router.Group("/items", g.middleware("items")...)
+	items.GET("", g.getItems)
+	items.HEAD("", g.getItems)
+	items.GET("/:id", g.getItem)
+	items.HEAD("/:id", g.getItem)
+	items.POST("", g.createItem)
+	items.PUT("/:id", g.updateItem)
+	items.DELETE("/:id", g.deleteItem)
+	items.POST("/:id/reservations", g.createReservation)
+	items.PUT("/:id/tags/:tag", g.tagItem)
+	items.DELETE("/:id/tags/:tag", g.untagItem)
+	g.registerWebhooks(router)
+}
+
+// cacheControl lets a client's own cache reuse item reads for cacheMaxAge,
+// while shared caches never store them, and keeps responses to changes out
+// of every cache.
+func (g *GoPOS) cacheControl(c *gin.Context) {
+	switch {
+	case c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead:
+		c.Header("Cache-Control", "no-store")
+	case g.cacheMaxAge > 0:
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(g.cacheMaxAge.Seconds())))
+	default:
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	// Responses depend on Accept, see wantsHAL.
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Next()
+}
+
+// getItems streams the items as a JSON array, or HAL collection, while they
+// are read, so memory use doesn't grow with the catalog. Once the first item
+// is sent the status can't change, so a later error ends the response early
+// and the client sees invalid JSON rather than a partial list. With
+// ?tag=sale&tag=organic only the items having every tag are listed.
 func (g *GoPOS) getItems(c *gin.Context) {
-	rows, err := g.db.Query("SELECT id, name, price FROM items")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if ids, ok := c.GetQuery("ids"); ok {
+		g.getItemsByID(c, ids)
 		return
 	}
-	defer rows.Close()
-
-	items := []Item{}
-	for rows.Next() {
-		var item Item
-		if err := rows.Scan(&item.ID, &item.Name, &item.Price); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	tags, ok := tagFilter(c)
+	if !ok {
+		return
+	}
+	each := g.store.EachItem
+	if len(tags) > 0 {
+		each = func(ctx context.Context, fn func(Item) error) error {
+			return g.store.EachTaggedItem(ctx, tags, fn)
 		}
-		items = append(items, item)
 	}
 
-	c.JSON(http.StatusOK, items)
+	format := jsonList
+	if wantsHAL(c) {
+		format = halList
+	}
+	open := format.open(c.Request.URL.RequestURI())
+
+	started := false
+	err := each(c.Request.Context(), func(item Item) error {
+		data, err := format.encode(item)
+		if err != nil {
+			return err
+		}
+		if !started {
+			started = true
+			c.Header("Content-Type", format.contentType)
+			c.Status(http.StatusOK)
+			data = append([]byte(open), data...)
+		} else {
+			data = append([]byte(","), data...)
+		}
+		_, err = c.Writer.Write(data)
+		return err
+	})
+	switch {
+	case err != nil && !started:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Listing items failed after the response started: %s", err)
+		c.Abort()
+	case !started:
+		c.Data(http.StatusOK, format.contentType, []byte(open+format.close))
+	default:
+		c.Writer.WriteString(format.close)
+	}
 }
 
 func (g *GoPOS) createItem(c *gin.Context) {
@@ -110,49 +321,42 @@ func (g *GoPOS) createItem(c *gin.Context) {
 		return
 	}
 
-	err := g.db.QueryRow("INSERT INTO items (name, price) VALUES ($1, $2) RETURNING id", item.Name, item.Price).Scan(&item.ID)
+	item, err := g.store.CreateItem(c.Request.Context(), item)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, item)
+	renderItem(c, http.StatusCreated, item)
 }
 
 func (g *GoPOS) updateItem(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := itemID(c)
+	if !ok {
+		return
+	}
 	var item Item
 	if err := c.ShouldBindJSON(&item); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	result, err := g.db.Exec("UPDATE items SET name = $1, price = $2 WHERE id = $3", item.Name, item.Price, id)
+	item, err := g.store.UpdateItem(c.Request.Context(), id, item)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storeError(c, err)
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, item)
+	renderItem(c, http.StatusOK, item)
 }
 
 func (g *GoPOS) deleteItem(c *gin.Context) {
-	id := c.Param("id")
-	result, err := g.db.Exec("DELETE FROM items WHERE id = $1", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	id, ok := itemID(c)
+	if !ok {
 		return
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	if err := g.store.DeleteItem(c.Request.Context(), id); err != nil {
+		storeError(c, err)
 		return
 	}
 
@@ -160,18 +364,81 @@ func (g *GoPOS) deleteItem(c *gin.Context) {
 }
 
 func (g *GoPOS) getItem(c *gin.Context) {
-	id := c.Param("id")
-	var item Item
-	err := g.db.QueryRow("SELECT id, name, price FROM items WHERE id = $1", id).Scan(&item.ID, &item.Name, &item.Price)
+	id, ok := itemID(c)
+	if !ok {
+		return
+	}
+	item, err := g.store.GetItem(c.Request.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		storeError(c, err)
+		return
+	}
+	renderItem(c, http.StatusOK, item)
+}
+
+// maxBatchIDs limits how many items one GET /items?ids= may ask for.
+const maxBatchIDs = 100
+
+// getItemsByID answers GET /items?ids=1,2,3 with the found items in the
+// requested order, and the ids that don't exist in "missing", so a client
+// can replace one GET per item with a single request.
+func (g *GoPOS) getItemsByID(c *gin.Context, list string) {
+	parts := strings.Split(list, ",")
+	if len(parts) > maxBatchIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids may be requested at once", maxBatchIDs)})
+		return
+	}
+
+	var ids []int
+	seen := map[int]bool{}
+	for _, s := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+			return
 		}
+		if !seen[int(id)] {
+			seen[int(id)] = true
+			ids = append(ids, int(id))
+		}
+	}
+	found, err := g.store.GetItems(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, item)
+	byID := make(map[int]Item, len(found))
+	for _, item := range found {
+		byID[item.ID] = item
+	}
+	items, missing := []Item{}, []int{}
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "missing": missing})
+}
+
+// itemID parses the :id path parameter, responding with 400 when it is not
+// a valid id.
+func itemID(c *gin.Context) (int, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item id"})
+		return 0, false
+	}
+	return int(id), true
+}
+
+func storeError(c *gin.Context, err error) {
+	if errors.Is(err, errItemNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 func (g GoPOS) Close() {
@@ -184,36 +451,38 @@ func (g GoPOS) getStatus(c *gin.Context) {
 	})
 }
 
-func initDB() (*sql.DB, error) {
-	viper.AutomaticEnv()
-
-	viper.SetDefault("DB_HOST", "localhost")
-	viper.SetDefault("DB_PORT", 5432)
-
-	user := viper.GetString("DB_USER")
-	password := viper.GetString("DB_PASSWORD")
-	dbname := viper.GetString("DB_NAME")
-	dbhost := viper.GetString("DB_HOST")
-	dbport := viper.GetInt("DB_PORT")
-	dbconnurl := viper.GetString("DB_CONN_URL")
-
-	_ = viper.GetString("GOPOS_HOST")
-	port := viper.GetString("GOPOS_PORT")
-
-	if port == "" {
-		port = defaultport
+// initStore connects to the database GOPOS_DB_DRIVER selects, "postgres"
+// by default. With "mysql" the returned db is nil, which turns off what only
+// Postgres serves.
+func initStore() (*sql.DB, ItemStore) {
+	if !usesMySQL() {
+		db, err := initDB()
+		if err != nil {
+			fmt.Println(err)
+		}
+		return db, newSQLItemStore(db)
 	}
+	db, err := openMySQL()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Successfully connected to MySQL!")
+	return nil, newMySQLItemStore(db)
+}
 
-	connStr := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable", user, password, dbhost, dbport, dbname)
-	fmt.Println(connStr)
-
-	if dbconnurl != "" {
-		connStr = dbconnurl
-		fmt.Println(connStr)
+func initDB() (*sql.DB, error) {
+	dsn, err := dbDSN()
+	if err != nil {
+		log.Fatal(err)
 	}
+	viper.SetDefault("DB_STATEMENT_TIMEOUT", "30s")
+	dsn.SetStatementTimeout(viper.GetDuration("DB_STATEMENT_TIMEOUT"))
+	log.Println("Connecting to database on url: ", dsn.Redacted())
 
-	var err error
-	db, err := sql.Open("postgres", connStr)
+	db, err := openDB(dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -226,3 +495,66 @@ func initDB() (*sql.DB, error) {
 	fmt.Println("Successfully connected to PostgreSQL!")
 	return db, err
 }
+
+// openDB opens a pool of pgx connections to dsn. Unlike sql.Open, a
+// cancelled context makes pgx ask the server to cancel the running query,
+// instead of only abandoning the connection while the query keeps running.
+func openDB(dsn DSN) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	config.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{
+			Conn: conn,
+			// Give up on the connection if the server ignores the cancel.
+			DeadlineDelay: 5 * time.Second,
+		}
+	}
+	return stdlib.OpenDB(*config), nil
+}
+
+func dbDSN() (DSN, error) {
+	viper.AutomaticEnv()
+
+	viper.SetDefault("DB_HOST", "localhost")
+	viper.SetDefault("DB_PORT", 5432)
+	viper.SetDefault("DB_SSLMODE", "disable")
+	viper.SetDefault("DB_APPLICATION_NAME", "gopos")
+
+	dbconnurl := viper.GetString("DB_CONN_URL")
+	if dbconnurl != "" {
+		dsn, err := ParseDSN(dbconnurl)
+		if err != nil {
+			return DSN{}, err
+		}
+		applyTLSConfig(&dsn)
+		return dsn, nil
+	}
+
+	dsn := DSN{
+		User:            viper.GetString("DB_USER"),
+		Password:        viper.GetString("DB_PASSWORD"),
+		Host:            viper.GetString("DB_HOST"),
+		Port:            viper.GetInt("DB_PORT"),
+		DBName:          viper.GetString("DB_NAME"),
+		SSLMode:         viper.GetString("DB_SSLMODE"),
+		ApplicationName: viper.GetString("DB_APPLICATION_NAME"),
+	}
+	applyTLSConfig(&dsn)
+	return dsn, nil
+}
+
+// applyTLSConfig sets the certificate paths from DB_SSLROOTCERT, DB_SSLCERT
+// and DB_SSLKEY, overriding any given in DB_CONN_URL.
+func applyTLSConfig(dsn *DSN) {
+	if v := viper.GetString("DB_SSLROOTCERT"); v != "" {
+		dsn.SSLRootCert = v
+	}
+	if v := viper.GetString("DB_SSLCERT"); v != "" {
+		dsn.SSLCert = v
+	}
+	if v := viper.GetString("DB_SSLKEY"); v != "" {
+		dsn.SSLKey = v
+	}
+}
@@ -1,228 +1,118 @@
+//go:build integration
+
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/stretchr/testify/assert"
-	"net/http"
+	"log"
 	"os"
-	"sync"
+	"os/signal"
 	"testing"
-	"time"
 )
 
-var localTestContainer *LocalTestContainer
-
 func TestMain(m *testing.M) {
-	var err error
-	localTestContainer, err = CreateLocalTestContainer()
-	if err != nil {
-		fmt.Printf("Error initializing Docker localTestContainer: %s", err)
-		os.Exit(1)
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(runUnit(m))
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func(p string) {
-		err := waitForServiceToBeReady(p)
-		if err != nil {
-			localTestContainer.Close()
-			panic(fmt.Errorf("Error waiting for local container to start: %w", err))
-		}
-		wg.Done()
-	}(localTestContainer.appport)
-
-	wg.Wait()
-
-	result := m.Run()
-
-	localTestContainer.Close()
-	os.Exit(result)
-}
-
-func waitForServiceToBeReady(port string) error {
-	limit := 30
-	wait := 250 * time.Millisecond
-	started := time.Now()
-	url := fmt.Sprintf("http://localhost:%s/%s", port, "health")
-
-	for i := 0; i < limit; i++ {
-		getReq, _ := http.NewRequest("GET", url, nil)
-		client := http.DefaultClient
-		getResp, err := client.Do(getReq)
+	// Room for parallel queries from the tests running with -parallel.
+	opts := []Option{WithShmSize("db", 256<<20), WithNetwork("backend", "app", "db")}
+	if os.Getenv("TEST_POSTGRES_TLS") != "" {
+		opts = append(opts, WithPostgresTLS())
+	}
+	if os.Getenv("TEST_POSTGRES_TMPFS") != "" {
+		opts = append(opts, WithPostgresTmpfs())
+	}
+	if os.Getenv("TEST_RACE") != "" {
+		opts = append(opts, WithRaceDetector())
+	}
+	if platform := os.Getenv("TEST_PLATFORM"); platform != "" {
+		opts = append(opts, WithPlatform(platform))
+	}
+	if os.Getenv("TEST_BUILDKIT") != "" {
+		opts = append(opts, WithBuildKit())
+	}
+	if dir := os.Getenv("TEST_BUILD_CACHE"); dir != "" {
+		opts = append(opts, WithBuildCache("type=local,src="+dir, "type=local,dest="+dir+",mode=max"))
+	}
+	if os.Getenv("TEST_IPV6") != "" {
+		opts = append(opts, WithIPv6Network())
+	}
+	if os.Getenv("TEST_LOG_STREAM") != "" {
+		opts = append(opts, WithLogStream(log.Printf))
+	}
+	if os.Getenv("TEST_TOXIPROXY") != "" {
+		opts = append(opts, WithToxiproxy())
+	}
+	if mode := os.Getenv("TEST_PGBOUNCER"); mode != "" {
+		opts = append(opts, WithPgBouncer(mode))
+	}
+	if os.Getenv("TEST_KAFKA") != "" {
+		opts = append(opts, WithKafka("item-events", "stock-adjustments"))
+	}
+	if names := os.Getenv("TEST_SIDECARS"); names != "" {
+		sidecars, err := sidecarOptions(names)
 		if err != nil {
-			time.Sleep(wait)
-			continue
-		}
-
-		if getResp.StatusCode == 200 {
-			return nil
+			fmt.Println(err)
+			os.Exit(1)
 		}
-		defer getResp.Body.Close()
-	}
-	return fmt.Errorf("the health endpoint didn't respond successfully within %f seconds.", time.Since(started).Seconds())
-}
-
-func TestCreateItem(t *testing.T) {
-	// Create an item to test retrieval
-	newItem := Item{
-		Name:  "Testitem",
-		Price: 201,
-	}
-	url := fmt.Sprintf("http://localhost:%s/%s", localTestContainer.appport, "items")
-	jsonValue, _ := json.Marshal(newItem)
-	createReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
-	createReq.Header.Set("Content-Type", "application/json")
-
-	client := http.DefaultClient
-	createResp, err := client.Do(createReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+		opts = append(opts, sidecars...)
 	}
-	defer createResp.Body.Close()
-
-	var createdItem Item
-	json.NewDecoder(createResp.Body).Decode(&createdItem)
-
-	// Test retrieving the created item
-	getReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/%d", url, createdItem.ID), nil)
-	getResp, err := client.Do(getReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+	if os.Getenv("TEST_DB_ENGINE") == "mysql" {
+		opts = append(opts, WithMySQL())
 	}
-	defer getResp.Body.Close()
-
-	assert.Equal(t, http.StatusOK, getResp.StatusCode)
-
-	var fetchedItem Item
-	json.NewDecoder(getResp.Body).Decode(&fetchedItem)
-
-	assert.Equal(t, createdItem.Name, fetchedItem.Name)
-	assert.Equal(t, createdItem.Price, fetchedItem.Price)
-}
-
-func TestGetItem(t *testing.T) {
-	// Create an item to test retrieval
-	newItem := Item{
-		Name:  "TestGetItem",
-		Price: 200,
-	}
-	url := fmt.Sprintf("http://localhost:%s/%s", localTestContainer.appport, "items")
-	jsonValue, _ := json.Marshal(newItem)
-	createReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
-	createReq.Header.Set("Content-Type", "application/json")
-
-	client := http.DefaultClient
-	createResp, err := client.Do(createReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+	if file := os.Getenv("TEST_COMPOSE_FILE"); file != "" {
+		opts = append(opts, WithComposeFile(file, "app", "db"))
 	}
-	defer createResp.Body.Close()
-
-	var createdItem Item
-	json.NewDecoder(createResp.Body).Decode(&createdItem)
-
-	// Test retrieving the created item
-	getReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/%d", url, createdItem.ID), nil)
-	getResp, err := client.Do(getReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+	if _, err := os.Stat("testenv.yaml"); err == nil {
+		opts = append(opts, WithTopology("testenv.yaml"))
 	}
-	defer getResp.Body.Close()
-
-	assert.Equal(t, http.StatusOK, getResp.StatusCode)
 
-	var fetchedItem Item
-	json.NewDecoder(getResp.Body).Decode(&fetchedItem)
+	// Interrupting a slow start stops it and cleans up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	assert.Equal(t, createdItem.Name, fetchedItem.Name)
-	assert.Equal(t, createdItem.Price, fetchedItem.Price)
-}
-
-func TestUpdateItem(t *testing.T) {
-	// Create an item to test updating
-	newItem := Item{
-		Name:  "TestUpdateItem",
-		Price: 300,
-	}
-	url := fmt.Sprintf("http://localhost:%s/%s", localTestContainer.appport, "items")
-	jsonValue, _ := json.Marshal(newItem)
-	createReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
-	createReq.Header.Set("Content-Type", "application/json")
-
-	client := http.DefaultClient
-	createResp, err := client.Do(createReq)
+	var err error
+	localTestContainer, err = CreateLocalTestContainerContext(ctx, opts...)
 	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+		fmt.Printf("Error initializing Docker localTestContainer: %s", err)
+		os.Exit(1)
 	}
-	defer createResp.Body.Close()
-
-	var createdItem Item
-	json.NewDecoder(createResp.Body).Decode(&createdItem)
 
-	// Test updating the created item
-	updateItem := Item{
-		Name:  "UpdatedItem",
-		Price: 400,
-	}
-	updateValue, _ := json.Marshal(updateItem)
-	updateReq, _ := http.NewRequest("PUT", fmt.Sprintf("%s/%d", url, createdItem.ID), bytes.NewBuffer(updateValue))
-	updateReq.Header.Set("Content-Type", "application/json")
-
-	updateResp, err := client.Do(updateReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+	if err := localTestContainer.WaitForApp(ctx); err != nil {
+		localTestContainer.Close()
+		panic(fmt.Errorf("Error waiting for local container to start: %w", err))
 	}
-	defer updateResp.Body.Close()
+	stop()
 
-	assert.Equal(t, http.StatusOK, updateResp.StatusCode)
+	client = newAPIClient(localTestContainer.AppBaseURL())
+	integrationEnv = true
 
-	var updatedItem Item
-	json.NewDecoder(updateResp.Body).Decode(&updatedItem)
-
-	assert.Equal(t, updateItem.Name, updatedItem.Name)
-	assert.Equal(t, updateItem.Price, updatedItem.Price)
-}
-
-func TestDeleteItem(t *testing.T) {
-	// Create an item to test deletion
-	newItem := Item{
-		Name:  "TestDeleteItem",
-		Price: 500,
-	}
-	url := fmt.Sprintf("http://localhost:%s/%s", localTestContainer.appport, "items")
-	jsonValue, _ := json.Marshal(newItem)
-	createReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
-	createReq.Header.Set("Content-Type", "application/json")
+	result := m.Run()
 
-	client := http.DefaultClient
-	createResp, err := client.Do(createReq)
+	races, err := localTestContainer.DataRaces()
 	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+		fmt.Printf("Could not read app container logs: %s\n", err)
 	}
-	defer createResp.Body.Close()
-
-	var createdItem Item
-	json.NewDecoder(createResp.Body).Decode(&createdItem)
-
-	// Test deleting the created item
-	deleteReq, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/%d", url, createdItem.ID), nil)
-	deleteResp, err := client.Do(deleteReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+	for _, race := range races {
+		fmt.Printf("The app reported a data race:\n%s\n", race)
+		result = 1
 	}
-	defer deleteResp.Body.Close()
 
-	assert.Equal(t, http.StatusNoContent, deleteResp.StatusCode)
+	closeTestDB()
+	writeFlakyReport()
+	localTestContainer.Close()
+	os.Exit(result)
+}
 
-	// Verify item deletion
-	getReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/%d", url, createdItem.ID), nil)
-	getResp, err := client.Do(getReq)
-	if err != nil {
-		t.Fatalf("Failed to send request: %v", err)
+// harnessDatabase shares the database of the container environment with the
+// data layer tests.
+func harnessDatabase() (*TestDatabase, error) {
+	if !integrationEnv || localTestContainer.dbHostMySQL != nil {
+		return nil, errNoTestDatabase
 	}
-	defer getResp.Body.Close()
-
-	assert.Equal(t, http.StatusNotFound, getResp.StatusCode)
+	return &TestDatabase{dsn: localTestContainer.dbHostDSN}, nil
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"sync"
+	"time"
+)
+
+// newMemRouter serves the API from an in-memory store. It deliberately has
+// no recovery middleware so handler panics fail the test.
+func newMemRouter() *gin.Engine {
+	return newStoreRouter(newMemItemStore())
+}
+
+// newStoreRouter serves the API from store.
+func newStoreRouter(store ItemStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	g := &GoPOS{store: store}
+	router := gin.New()
+	handleMethods(router)
+	g.enableFaultInjection(router)
+	g.enableFakeClock(router)
+	g.registerRoutes(router)
+	return router
+}
+
+// memItemStore is an in-memory ItemStore for exercising handlers without a
+// database.
+type memItemStore struct {
+	mu           sync.Mutex
+	nextID       int
+	items        map[int]Item
+	reservations []Reservation
+	// tags holds the tags of each item.
+	tags map[int]map[string]bool
+}
+
+func newMemItemStore() *memItemStore {
+	return &memItemStore{nextID: 1, items: map[int]Item{}, tags: map[int]map[string]bool{}}
+}
+
+func (s *memItemStore) ListItems(ctx context.Context) ([]Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]Item, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func (s *memItemStore) EachItem(ctx context.Context, fn func(Item) error) error {
+	items, _ := s.ListItems(ctx)
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memItemStore) EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) error {
+	items, _ := s.ListItems(ctx)
+
+	s.mu.Lock()
+	tagged := items[:0]
+	for _, item := range items {
+		if s.hasTags(item.ID, tags) {
+			tagged = append(tagged, item)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, item := range tagged {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memItemStore) hasTags(id int, tags []string) bool {
+	for _, tag := range tags {
+		if !s.tags[id][tag] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *memItemStore) GetItem(ctx context.Context, id int) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return Item{}, errItemNotFound
+	}
+	return item, nil
+}
+
+func (s *memItemStore) GetItems(ctx context.Context, ids []int) ([]Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := []Item{}
+	for _, id := range ids {
+		if item, ok := s.items[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (s *memItemStore) CreateItem(ctx context.Context, item Item) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item.ID = s.nextID
+	s.nextID++
+	s.items[item.ID] = item
+	return item, nil
+}
+
+func (s *memItemStore) UpdateItem(ctx context.Context, id int, item Item) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return Item{}, errItemNotFound
+	}
+	item.ID = id
+	s.items[id] = item
+	return item, nil
+}
+
+func (s *memItemStore) DeleteItem(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return errItemNotFound
+	}
+	delete(s.items, id)
+	delete(s.tags, id)
+	return nil
+}
+
+func (s *memItemStore) ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return Reservation{}, errItemNotFound
+	}
+	if item.Stock < quantity {
+		return Reservation{}, errInsufficientStock
+	}
+	item.Stock -= quantity
+	s.items[id] = item
+
+	r := Reservation{ID: len(s.reservations) + 1, ItemID: id, Quantity: quantity, ExpiresAt: expiresAt}
+	s.reservations = append(s.reservations, r)
+	return r, nil
+}
+
+func (s *memItemStore) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for i, r := range s.reservations {
+		if r.Quantity == 0 || r.ExpiresAt.After(now) {
+			continue
+		}
+		if item, ok := s.items[r.ItemID]; ok {
+			item.Stock += r.Quantity
+			s.items[r.ItemID] = item
+		}
+		// Keep the slot so reservation ids stay unique.
+		s.reservations[i].Quantity = 0
+		n++
+	}
+	return n, nil
+}
+
+func (s *memItemStore) TagItem(ctx context.Context, id int, tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return errItemNotFound
+	}
+	if s.tags[id] == nil {
+		s.tags[id] = map[string]bool{}
+	}
+	s.tags[id][tag] = true
+	return nil
+}
+
+func (s *memItemStore) UntagItem(ctx context.Context, id int, tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tags[id], tag)
+	return nil
+}
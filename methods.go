@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// handleMethods makes router answer requests for a known path with 405 and
+// an Allow header instead of 404 when the method doesn't match, and answers
+// OPTIONS with the allowed methods.
+func handleMethods(router *gin.Engine) {
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(func(c *gin.Context) {
+		allowed := allowedMethods(router, c.Request.URL.Path)
+		if len(allowed) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.Header("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		if c.Request.Method == http.MethodOptions {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+	})
+}
+
+// allowedMethods lists the methods router has a route for at path.
+func allowedMethods(router *gin.Engine, path string) []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, route := range router.Routes() {
+		if !seen[route.Method] && routeMatches(route.Path, path) {
+			seen[route.Method] = true
+			methods = append(methods, route.Method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// routeMatches reports whether path matches a gin route pattern with :param
+// and *catchall segments.
+func routeMatches(pattern string, path string) bool {
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(p, ":") && p != segments[i] {
+			return false
+		}
+		if strings.HasPrefix(p, ":") && segments[i] == "" {
+			return false
+		}
+	}
+	return len(patterns) == len(segments)
+}
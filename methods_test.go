@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := newMemRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/items/1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, PUT, OPTIONS", w.Header().Get("Allow"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/items", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestOptions(t *testing.T) {
+	w := httptest.NewRecorder()
+	newMemRouter().ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/items", nil))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, POST, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestHead(t *testing.T) {
+	status, body := client.Do(t, http.MethodHead, "/health", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, body)
+
+	item := factory.Item(t)
+	status, _ = client.Do(t, http.MethodHead, fmt.Sprintf("/items/%d", item.ID), nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = client.Do(t, http.MethodHead, "/items/0", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestRouteMatches(t *testing.T) {
+	assert.True(t, routeMatches("/items/:id", "/items/1"))
+	assert.True(t, routeMatches("/items", "/items/"))
+	assert.True(t, routeMatches("/admin/*filepath", "/admin/app.js"))
+	assert.False(t, routeMatches("/items/:id", "/items"))
+	assert.False(t, routeMatches("/items", "/items/1"))
+	assert.False(t, routeMatches("/health", "/items"))
+}
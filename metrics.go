@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"time"
+)
+
+// storeMetrics records the duration and failures of every store call, and
+// logs and counts the calls slower than slowThreshold.
+type storeMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	slow     *prometheus.CounterVec
+	// slowThreshold disables slow query logging when zero.
+	slowThreshold time.Duration
+}
+
+func newStoreMetrics(reg prometheus.Registerer) *storeMetrics {
+	m := &storeMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "gopos",
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of item store queries.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"query"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gopos",
+			Subsystem: "db",
+			Name:      "query_errors_total",
+			Help:      "Item store queries that failed. Missing items are not errors.",
+		}, []string{"query"}),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "gopos",
+			Subsystem: "db",
+			Name:      "slow_queries_total",
+			Help:      "Item store queries that took longer than GOPOS_SLOW_QUERY_THRESHOLD.",
+		}, []string{"query"}),
+	}
+	reg.MustRegister(m.duration, m.errors, m.slow)
+	return m
+}
+
+// observe records a call that started at start. It takes the call's error by
+// reference so it can be deferred before the call returns.
+func (m *storeMetrics) observe(query string, start time.Time, err *error) {
+	elapsed := time.Since(start)
+	m.duration.WithLabelValues(query).Observe(elapsed.Seconds())
+	if m.slowThreshold > 0 && elapsed > m.slowThreshold {
+		m.slow.WithLabelValues(query).Inc()
+		// Only the query name is logged, its arguments may be customer data.
+		log.Printf("Slow query %s took %s (threshold %s, arguments redacted)", query, elapsed, m.slowThreshold)
+	}
+	if *err != nil && !errors.Is(*err, errItemNotFound) {
+		m.errors.WithLabelValues(query).Inc()
+	}
+}
+
+// enableMetrics instruments the store and the database pool, registering
+// the collectors with reg. Like enableFaultInjection it must be called before
+// registerRoutes.
+func (g *GoPOS) enableMetrics(reg *prometheus.Registry) {
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if g.db != nil {
+		reg.MustRegister(collectors.NewDBStatsCollector(g.db, "gopos"))
+	}
+	metrics := newStoreMetrics(reg)
+	metrics.slowThreshold = g.slowQueryThreshold
+	g.store = metricsStore{g.store, metrics}
+}
+
+// registerMetrics serves the metrics in reg on /metrics.
+func registerMetrics(router gin.IRouter, reg *prometheus.Registry) {
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+}
+
+// metricsStore records store calls in storeMetrics.
+type metricsStore struct {
+	ItemStore
+	metrics *storeMetrics
+}
+
+func (s metricsStore) ListItems(ctx context.Context) (items []Item, err error) {
+	defer s.metrics.observe("list", time.Now(), &err)
+	return s.ItemStore.ListItems(ctx)
+}
+
+func (s metricsStore) EachItem(ctx context.Context, fn func(Item) error) (err error) {
+	defer s.metrics.observe("list", time.Now(), &err)
+	return s.ItemStore.EachItem(ctx, fn)
+}
+
+func (s metricsStore) EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) (err error) {
+	defer s.metrics.observe("list_tagged", time.Now(), &err)
+	return s.ItemStore.EachTaggedItem(ctx, tags, fn)
+}
+
+func (s metricsStore) GetItem(ctx context.Context, id int) (item Item, err error) {
+	defer s.metrics.observe("get", time.Now(), &err)
+	return s.ItemStore.GetItem(ctx, id)
+}
+
+func (s metricsStore) GetItems(ctx context.Context, ids []int) (items []Item, err error) {
+	defer s.metrics.observe("get_many", time.Now(), &err)
+	return s.ItemStore.GetItems(ctx, ids)
+}
+
+func (s metricsStore) CreateItem(ctx context.Context, item Item) (created Item, err error) {
+	defer s.metrics.observe("create", time.Now(), &err)
+	return s.ItemStore.CreateItem(ctx, item)
+}
+
+func (s metricsStore) UpdateItem(ctx context.Context, id int, item Item) (updated Item, err error) {
+	defer s.metrics.observe("update", time.Now(), &err)
+	return s.ItemStore.UpdateItem(ctx, id, item)
+}
+
+func (s metricsStore) DeleteItem(ctx context.Context, id int) (err error) {
+	defer s.metrics.observe("delete", time.Now(), &err)
+	return s.ItemStore.DeleteItem(ctx, id)
+}
+
+func (s metricsStore) ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (r Reservation, err error) {
+	defer s.metrics.observe("reserve", time.Now(), &err)
+	return s.ItemStore.ReserveItem(ctx, id, quantity, expiresAt)
+}
+
+func (s metricsStore) ExpireReservations(ctx context.Context, now time.Time) (n int64, err error) {
+	defer s.metrics.observe("expire_reservations", time.Now(), &err)
+	return s.ItemStore.ExpireReservations(ctx, now)
+}
+
+func (s metricsStore) TagItem(ctx context.Context, id int, tag string) (err error) {
+	defer s.metrics.observe("tag", time.Now(), &err)
+	return s.ItemStore.TagItem(ctx, id, tag)
+}
+
+func (s metricsStore) UntagItem(ctx context.Context, id int, tag string) (err error) {
+	defer s.metrics.observe("untag", time.Now(), &err)
+	return s.ItemStore.UntagItem(ctx, id, tag)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := newStoreMetrics(reg)
+	store := metricsStore{faultyStore{newMemItemStore()}, metrics}
+	ctx := context.Background()
+
+	item, err := store.CreateItem(ctx, Item{Name: "TestStoreMetrics", Price: 1})
+	assert.NoError(t, err)
+	_, err = store.GetItem(ctx, item.ID)
+	assert.NoError(t, err)
+	_, err = store.GetItem(ctx, item.ID+1)
+	assert.ErrorIs(t, err, errItemNotFound)
+	_, err = store.GetItem(context.WithValue(ctx, dbFaultKey{}, true), item.ID)
+	assert.ErrorIs(t, err, errInjectedFault)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.duration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("get")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.errors.WithLabelValues("create")))
+}
+
+func TestSlowQueries(t *testing.T) {
+	metrics := newStoreMetrics(prometheus.NewRegistry())
+	metrics.slowThreshold = 10 * time.Millisecond
+	var err error
+
+	metrics.observe("get", time.Now(), &err)
+	metrics.observe("list", time.Now().Add(-time.Second), &err)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.slow.WithLabelValues("get")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.slow.WithLabelValues("list")))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	g := &GoPOS{store: newMemItemStore()}
+	g.enableMetrics(reg)
+	router := gin.New()
+	g.registerRoutes(router)
+	registerMetrics(router, reg)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `gopos_db_query_duration_seconds_count{query="list"} 1`), w.Body.String())
+}
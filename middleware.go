@@ -0,0 +1,256 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// middlewareGroups are the route groups whose middleware can be configured,
+// with the chain each gets by default. "api" wraps every API route, "items"
+// the /items routes, "admin" the admin listener and "dashboard" the /admin
+// routes.
+var middlewareGroups = map[string][]string{
+	"api":       {"logger", "recovery"},
+	"items":     {"cache-control"},
+	"admin":     {"logger", "recovery"},
+	"dashboard": {"basic-auth", "statement-timeout"},
+}
+
+// requiredMiddleware must stay in the chain of their group, so configuring
+// it can't expose the dashboard without credentials.
+var requiredMiddleware = map[string][]string{
+	"dashboard": {"basic-auth"},
+}
+
+// middlewareFactories builds the middleware a chain may name. The fault
+// injector isn't one: it is test-only, see enableFaultInjection.
+var middlewareFactories = map[string]func(g *GoPOS) gin.HandlerFunc{
+	"logger":   func(*GoPOS) gin.HandlerFunc { return gin.Logger() },
+	"recovery": func(*GoPOS) gin.HandlerFunc { return gin.Recovery() },
+	"cache-control": func(g *GoPOS) gin.HandlerFunc {
+		return g.cacheControl
+	},
+	"cors": func(*GoPOS) gin.HandlerFunc {
+		return cors(strings.Split(viper.GetString("GOPOS_CORS_ORIGINS"), ","))
+	},
+	"gzip": func(*GoPOS) gin.HandlerFunc { return compress },
+	"auth": func(*GoPOS) gin.HandlerFunc {
+		return bearerAuth(apiTokens())
+	},
+	"basic-auth": func(*GoPOS) gin.HandlerFunc {
+		return gin.BasicAuth(gin.Accounts{viper.GetString("ADMIN_USER"): viper.GetString("ADMIN_PASSWORD")})
+	},
+	"statement-timeout": func(*GoPOS) gin.HandlerFunc { return statementTimeout },
+	"rate-limit": func(*GoPOS) gin.HandlerFunc {
+		return newRateLimiter(viper.GetFloat64("GOPOS_RATE_LIMIT"), viper.GetInt("GOPOS_RATE_BURST")).limit
+	},
+	"tracing": func(*GoPOS) gin.HandlerFunc { return tracing },
+}
+
+// middlewareChecks validate the settings of the middleware that need some,
+// so a chain naming them fails at startup rather than on every request.
+var middlewareChecks = map[string]func() error{
+	"auth": func() error {
+		if len(apiTokens()) == 0 {
+			return errors.New("auth needs GOPOS_API_TOKENS")
+		}
+		return nil
+	},
+	"rate-limit": func() error {
+		if viper.GetFloat64("GOPOS_RATE_LIMIT") <= 0 || viper.GetInt("GOPOS_RATE_BURST") < 1 {
+			return errors.New("rate-limit needs a positive GOPOS_RATE_LIMIT and GOPOS_RATE_BURST")
+		}
+		return nil
+	},
+}
+
+// loadMiddleware reads the chain of each group from GOPOS_MIDDLEWARE_<GROUP>,
+// e.g. GOPOS_MIDDLEWARE_API=logger,recovery,gzip, so deployments can turn
+// cross-cutting features on and off without code changes. "none" empties a
+// chain. Unknown names, missing required middleware and middleware missing
+// their settings are an error rather than silently skipped.
+func loadMiddleware() (map[string][]string, error) {
+	viper.SetDefault("GOPOS_RATE_LIMIT", 10)
+	viper.SetDefault("GOPOS_RATE_BURST", 20)
+	chains := map[string][]string{}
+	for group, chain := range middlewareGroups {
+		if v := viper.GetString("GOPOS_MIDDLEWARE_" + strings.ToUpper(group)); v != "" {
+			chain = nil
+			if v != "none" {
+				for _, name := range strings.Split(v, ",") {
+					chain = append(chain, strings.TrimSpace(name))
+				}
+			}
+		}
+		for _, name := range chain {
+			if middlewareFactories[name] == nil {
+				return nil, fmt.Errorf("unknown middleware %q in the %s chain", name, group)
+			}
+			if check := middlewareChecks[name]; check != nil {
+				if err := check(); err != nil {
+					return nil, fmt.Errorf("the %s chain: %w", group, err)
+				}
+			}
+		}
+		for _, name := range requiredMiddleware[group] {
+			if !slices.Contains(chain, name) {
+				return nil, fmt.Errorf("the %s chain must include %s", group, name)
+			}
+		}
+		chains[group] = chain
+	}
+	return chains, nil
+}
+
+// middleware builds the chain of group, the default one unless
+// loadMiddleware's result was set in g.middlewareChains.
+func (g *GoPOS) middleware(group string) []gin.HandlerFunc {
+	chain, ok := g.middlewareChains[group]
+	if !ok {
+		chain = middlewareGroups[group]
+	}
+	handlers := make([]gin.HandlerFunc, 0, len(chain))
+	for _, name := range chain {
+		handlers = append(handlers, middlewareFactories[name](g))
+	}
+	return handlers
+}
+
+// cors lets pages from origins call the API. "*" allows any origin.
+func cors(origins []string) gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, o := range origins {
+		allowed[strings.TrimSpace(o)] = true
+	}
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowed["*"] && !allowed[origin]) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Add("Vary", "Origin")
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE")
+			c.Header("Access-Control-Allow-Headers", "Accept, Content-Type")
+		}
+		c.Next()
+	}
+}
+
+// apiTokens are the bearer tokens of GOPOS_API_TOKENS, comma-separated.
+func apiTokens() []string {
+	var tokens []string
+	for _, token := range strings.Split(viper.GetString("GOPOS_API_TOKENS"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// bearerAuth lets requests through with one of tokens in their
+// Authorization header. Tokens are compared in constant time.
+func bearerAuth(tokens []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			for _, t := range tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid bearer token"})
+	}
+}
+
+// tracing continues the W3C trace of the request's traceparent header, or
+// starts one, and answers with the traceparent of the request's span. The
+// trace ID is kept in the context as "trace_id", for logs.
+func tracing(c *gin.Context) {
+	traceID, flags := parseTraceparent(c.GetHeader("traceparent"))
+	if traceID == "" {
+		traceID, flags = randomHex(16), "01"
+	}
+	c.Set("trace_id", traceID)
+	c.Header("traceparent", "00-"+traceID+"-"+randomHex(8)+"-"+flags)
+	c.Next()
+}
+
+// parseTraceparent returns the trace ID and flags of a version 00
+// traceparent header, or empty strings if it isn't one.
+func parseTraceparent(header string) (traceID string, flags string) {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return "", ""
+	}
+	// All zeros is an invalid ID.
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", ""
+	}
+	return parts[1], parts[3]
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// compress gzips responses for clients accepting it. The gzip stream only
+// starts with the body, so responses without one are left alone.
+func compress(c *gin.Context) {
+	if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Next()
+		return
+	}
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	c.Next()
+	if w.zw != nil {
+		w.zw.Close()
+	}
+}
+
+type gzipWriter struct {
+	gin.ResponseWriter
+	zw *gzip.Writer
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.zw == nil {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.zw = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.zw.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
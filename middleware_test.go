@@ -0,0 +1,139 @@
+package main
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadMiddleware(t *testing.T) {
+	viper.AutomaticEnv()
+	t.Setenv("GOPOS_MIDDLEWARE_API", "recovery, gzip")
+	t.Setenv("GOPOS_MIDDLEWARE_ITEMS", "none")
+
+	chains, err := loadMiddleware()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"recovery", "gzip"}, chains["api"])
+	assert.Empty(t, chains["items"])
+	assert.Equal(t, middlewareGroups["admin"], chains["admin"])
+
+	t.Setenv("GOPOS_MIDDLEWARE_ADMIN", "logger,tracer")
+	_, err = loadMiddleware()
+	assert.EqualError(t, err, `unknown middleware "tracer" in the admin chain`)
+	t.Setenv("GOPOS_MIDDLEWARE_ADMIN", "")
+
+	// Every middleware the app has can be named.
+	t.Setenv("GOPOS_API_TOKENS", "t1")
+	t.Setenv("GOPOS_MIDDLEWARE_API", "logger,recovery,tracing,rate-limit,auth,cors,gzip")
+	t.Setenv("GOPOS_MIDDLEWARE_DASHBOARD", "statement-timeout, basic-auth")
+	chains, err = loadMiddleware()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"logger", "recovery", "tracing", "rate-limit", "auth", "cors", "gzip"}, chains["api"])
+	assert.Equal(t, []string{"statement-timeout", "basic-auth"}, chains["dashboard"])
+}
+
+func TestLoadMiddlewareChecks(t *testing.T) {
+	viper.AutomaticEnv()
+
+	t.Setenv("GOPOS_MIDDLEWARE_DASHBOARD", "none")
+	_, err := loadMiddleware()
+	assert.EqualError(t, err, "the dashboard chain must include basic-auth")
+	t.Setenv("GOPOS_MIDDLEWARE_DASHBOARD", "")
+
+	t.Setenv("GOPOS_MIDDLEWARE_ITEMS", "auth")
+	_, err = loadMiddleware()
+	assert.EqualError(t, err, "the items chain: auth needs GOPOS_API_TOKENS")
+
+	t.Setenv("GOPOS_MIDDLEWARE_ITEMS", "rate-limit")
+	t.Setenv("GOPOS_RATE_LIMIT", "0")
+	_, err = loadMiddleware()
+	assert.EqualError(t, err, "the items chain: rate-limit needs a positive GOPOS_RATE_LIMIT and GOPOS_RATE_BURST")
+}
+
+func TestBearerAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(bearerAuth([]string{"t1", "t2"}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for header, want := range map[string]int{
+		"":          http.StatusUnauthorized,
+		"Bearer t3": http.StatusUnauthorized,
+		"Basic t1":  http.StatusUnauthorized,
+		"Bearer t2": http.StatusNoContent,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, header)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing)
+	var traceID any
+	router.GET("/", func(c *gin.Context) { traceID, _ = c.Get("trace_id") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Regexp(t, `^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$`, w.Header().Get("traceparent"))
+	assert.NotContains(t, w.Header().Get("traceparent"), "00f067aa0ba902b7")
+
+	// An invalid traceparent starts a new trace.
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Regexp(t, `^[0-9a-f]{32}$`, traceID)
+	assert.NotEqual(t, "00000000000000000000000000000000", traceID)
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, w.Header().Get("traceparent"))
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	viper.AutomaticEnv()
+	t.Setenv("GOPOS_CORS_ORIGINS", "https://shop.example")
+	gin.SetMode(gin.TestMode)
+	g := &GoPOS{store: newMemItemStore(), middlewareChains: map[string][]string{
+		"api":   {"cors", "gzip"},
+		"items": nil,
+	}}
+	router := gin.New()
+	router.Use(g.middleware("api")...)
+	g.registerRoutes(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Origin", "https://shop.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://shop.example", w.Header().Get("Access-Control-Allow-Origin"))
+	// The items chain is empty, so there is no cache-control.
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(body))
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
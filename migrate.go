@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migration is one versioned step from the migrations directory, in the
+// golang-migrate file layout (<version>_<name>.up.sql / .down.sql).
+type migration struct {
+	version uint
+	up      string
+	down    string
+}
+
+// loadMigrations reads the migrations in dir ordered by version.
+func loadMigrations(dir string) ([]migration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*migration{}
+	for _, f := range files {
+		name := filepath.Base(f)
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+		m := byVersion[uint(version)]
+		if m == nil {
+			m = &migration{version: uint(version)}
+			byVersion[uint(version)] = m
+		}
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			m.up = f
+		case strings.HasSuffix(name, ".down.sql"):
+			m.down = f
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migrateUp applies every migration in dir newer than the current version.
+// It keeps the schema_migrations table the same way golang-migrate does, so
+// either tool can be used on the same database.
+func migrateUp(db *sql.DB, dir string) error {
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		return err
+	}
+	current, err := migrationVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current || m.up == "" {
+			continue
+		}
+		if err := runMigration(db, m.version, m.up); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationVersion creates schema_migrations if needed and returns the
+// applied version, or 0 on a fresh database.
+func migrationVersion(db *sql.DB) (uint, error) {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)")
+	if err != nil {
+		return 0, err
+	}
+
+	var version uint
+	var dirty bool
+	err = db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migration version %d is dirty", version)
+	}
+	return version, nil
+}
+
+// runMigration executes file and records version, leaving the version marked
+// dirty when the file fails.
+func runMigration(db *sql.DB, version uint, file string) error {
+	statements, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := setMigrationVersion(db, version, true); err != nil {
+		return err
+	}
+	if _, err := db.Exec(string(statements)); err != nil {
+		return fmt.Errorf("migration %s: %w", filepath.Base(file), err)
+	}
+	return setMigrationVersion(db, version, false)
+}
+
+func setMigrationVersion(db *sql.DB, version uint, dirty bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	if version > 0 {
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, dirty); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateDown reverts every applied migration in dir, newest first.
+func migrateDown(db *sql.DB, dir string) error {
+	migrations, err := loadMigrations(dir)
+	if err != nil {
+		return err
+	}
+	current, err := migrationVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current {
+			continue
+		}
+		if m.down == "" {
+			return fmt.Errorf("migration %d has no down migration", m.version)
+		}
+		var previous uint
+		if i > 0 {
+			previous = migrations[i-1].version
+		}
+		if err := runMigration(db, previous, m.down); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMigrationRoundTrip migrates an empty database up, down and up again
+// and fails when the down migrations leave anything behind or the second up
+// produces a different schema than the first.
+func checkMigrationRoundTrip(db *sql.DB, dir string) error {
+	empty, err := schemaSnapshot(db)
+	if err != nil {
+		return err
+	}
+	if err := migrateUp(db, dir); err != nil {
+		return fmt.Errorf("first up: %w", err)
+	}
+	migrated, err := schemaSnapshot(db)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateDown(db, dir); err != nil {
+		return fmt.Errorf("down: %w", err)
+	}
+	reverted, err := schemaSnapshot(db)
+	if err != nil {
+		return err
+	}
+	if diff := diffLines(empty, reverted); diff != "" {
+		return fmt.Errorf("down migrations left schema behind:\n%s", diff)
+	}
+
+	if err := migrateUp(db, dir); err != nil {
+		return fmt.Errorf("second up: %w", err)
+	}
+	remigrated, err := schemaSnapshot(db)
+	if err != nil {
+		return err
+	}
+	if diff := diffLines(migrated, remigrated); diff != "" {
+		return fmt.Errorf("second up produced a different schema:\n%s", diff)
+	}
+	return nil
+}
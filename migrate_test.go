@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	db := requireFreshDB(t)
+
+	if err := checkMigrationRoundTrip(db, "./db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"000010_add_tags.up.sql",
+		"000010_add_tags.down.sql",
+		"000002_add_stock.up.sql",
+		"000002_add_stock.down.sql",
+		"README.md",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	migrations, err := loadMigrations(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []migration{
+		{version: 2, up: filepath.Join(dir, "000002_add_stock.up.sql"), down: filepath.Join(dir, "000002_add_stock.down.sql")},
+		{version: 10, up: filepath.Join(dir, "000010_add_tags.up.sql"), down: filepath.Join(dir, "000010_add_tags.down.sql")},
+	}, migrations)
+}
+
+func TestDiffLines(t *testing.T) {
+	assert.Equal(t, "", diffLines("a\nb", "b\na"))
+	assert.Equal(t, "- b\n+ c", diffLines("a\nb", "a\nc"))
+}
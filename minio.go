@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+const minioImage = "minio/minio:RELEASE.2024-06-13T22-53-53Z"
+
+// The credentials of the MinIO server.
+const (
+	minioAccessKey = "gopos"
+	minioSecretKey = "gopos-secret"
+)
+
+// WithMinIO starts a MinIO object store on the test network with bucket
+// created, and points the app at it with S3_ENDPOINT, S3_BUCKET and the S3
+// credentials. Use S3Endpoint to reach it from the tests.
+func WithMinIO(bucket string) Option {
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:  "minio",
+			image: minioImage,
+			appEnv: []string{
+				"S3_ENDPOINT=http://minio:9000",
+				"S3_REGION=us-east-1",
+				"S3_BUCKET=" + bucket,
+				"S3_ACCESS_KEY_ID=" + minioAccessKey,
+				"S3_SECRET_ACCESS_KEY=" + minioSecretKey,
+			},
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return createMinIO(ctx, pool, network, o, host, bucket)
+			},
+		})
+	}
+}
+
+// createMinIO starts MinIO, waits until it is ready and creates the bucket
+// with the mc client of the image.
+func createMinIO(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, bucket string) (*dockertest.Resource, error) {
+	resource, err := startService(ctx, pool, network, o, host, "minio", ServiceSpec{
+		Image:   minioImage,
+		Command: []string{"server", "/data", "--console-address", ":9001"},
+		Env: map[string]string{
+			"MINIO_ROOT_USER":     minioAccessKey,
+			"MINIO_ROOT_PASSWORD": minioSecretKey,
+		},
+		Ports: []string{"9000", "9001"},
+		Wait:  WaitSpec{HTTP: &HTTPWait{Port: "9000", Path: "/minio/health/ready"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = execOK(resource, "mc", "alias", "set", "local", "http://localhost:9000", minioAccessKey, minioSecretKey)
+	if err == nil {
+		err = execOK(resource, "mc", "mb", "--ignore-existing", "local/"+bucket)
+	}
+	if err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("could not create bucket %s: %w", bucket, err)
+	}
+	return resource, nil
+}
+
+// S3Endpoint returns the URL the tests reach the WithMinIO object store at,
+// with its access and secret key.
+func (l LocalTestContainer) S3Endpoint() (endpoint string, accessKey string, secretKey string, err error) {
+	addr, err := l.ServiceAddr("minio", "9000")
+	if err != nil {
+		return "", "", "", err
+	}
+	return "http://" + addr, minioAccessKey, minioSecretKey, nil
+}
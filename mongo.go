@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+const mongoImage = "mongo:7"
+
+// WithMongo starts a single-member MongoDB replica set on the test network,
+// so transactions and change streams work, and points the app at it with
+// MONGO_URL. Use MongoURI to reach it from the tests.
+func WithMongo() Option {
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:   "mongo",
+			image:  mongoImage,
+			appEnv: []string{"MONGO_URL=mongodb://mongo:27017/gopos?replicaSet=rs0"},
+			start:  createMongo,
+		})
+	}
+}
+
+// createMongo starts MongoDB, initiates the replica set and waits until the
+// member is primary.
+func createMongo(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+	resource, err := startService(ctx, pool, network, o, host, "mongo", ServiceSpec{
+		Image:   mongoImage,
+		Command: []string{"--replSet", "rs0", "--bind_ip_all"},
+		Ports:   []string{"27017"},
+		waits:   []WaitStrategy{WaitForExec("mongosh", "--quiet", "--eval", "db.adminCommand('ping')")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The member is named by its alias, which the app resolves.
+	err = execOK(resource, "mongosh", "--quiet", "--eval",
+		"rs.initiate({_id: 'rs0', members: [{_id: 0, host: 'mongo:27017'}]})")
+	if err == nil {
+		target := WaitTarget{Pool: pool, Resource: resource, Host: host}
+		err = waitFor(ctx, target, nil, waitForExecOutput("true", "mongosh", "--quiet", "--eval", "db.hello().isWritablePrimary"))
+	}
+	if err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("mongo didn't come up: %w", err)
+	}
+	return resource, nil
+}
+
+// MongoURI returns the connection string the tests reach the WithMongo
+// database at. It connects directly, as the replica set names its member
+// by the alias only the test network resolves.
+func (l LocalTestContainer) MongoURI() (string, error) {
+	addr, err := l.ServiceAddr("mongo", "27017")
+	if err != nil {
+		return "", err
+	}
+	return "mongodb://" + addr + "/gopos?directConnection=true", nil
+}
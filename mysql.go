@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net"
+)
+
+const (
+	defaultMySQLTag    = "8.4"
+	mysqlPort          = "3306"
+	mysqlMigrationsDir = "./db/mysql/migrations"
+)
+
+// WithMySQL runs the database in MySQL instead of Postgres, migrated with
+// the migrations in ./db/mysql/migrations unless WithMigrationsDir says
+// otherwise, and starts the app with GOPOS_DB_DRIVER=mysql. The app then
+// serves the items API only, see mysqlItemStore. The Postgres options, like
+// WithPostgresTLS or WithPgBouncer, can't be combined with it.
+func WithMySQL() Option {
+	return func(o *options) {
+		o.mysql = true
+		if o.migrationsDir == defaultMigrationsDir {
+			o.migrationsDir = mysqlMigrationsDir
+		}
+	}
+}
+
+// WithMySQLImage runs the database of WithMySQL from another image.
+func WithMySQLImage(repository string, tag string) Option {
+	return func(o *options) {
+		o.mysqlRepo = repository
+		o.mysqlTag = tag
+	}
+}
+
+// dbDriver is the GOPOS_DB_DRIVER the app container runs with.
+func (o *options) dbDriver() string {
+	if o.mysql {
+		return mysqlDriver
+	}
+	return "postgres"
+}
+
+// checkMySQL rejects the options WithMySQL can't honor.
+func checkMySQL(o *options) error {
+	var unsupported []string
+	if o.postgresTLS {
+		unsupported = append(unsupported, "WithPostgresTLS")
+	}
+	if o.postgresTmpfs {
+		unsupported = append(unsupported, "WithPostgresTmpfs")
+	}
+	if o.pgbouncer != "" {
+		unsupported = append(unsupported, "WithPgBouncer")
+	}
+	if o.toxiproxy {
+		unsupported = append(unsupported, "WithToxiproxy")
+	}
+	if o.composeFile != "" {
+		unsupported = append(unsupported, "WithComposeFile")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("WithMySQL can't be combined with %v", unsupported)
+	}
+	return nil
+}
+
+// mysqlConfig returns the connection settings of the test database
+// reachable at host:port.
+func (o *options) mysqlConfig(host string, port string) *mysql.Config {
+	config := mysql.NewConfig()
+	config.User = o.dbUser
+	config.Passwd = o.dbPassword
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(host, port)
+	config.DBName = o.dbDatabase
+	config.ParseTime = true
+	return config
+}
+
+// mysqlMigrateURL is the -database URL of golang-migrate for the test
+// database at host:port. Its MySQL driver takes the go-sql-driver DSN
+// behind the scheme, and needs multiStatements for migrations of more than
+// one statement.
+func (o *options) mysqlMigrateURL(host string, port string) string {
+	config := o.mysqlConfig(host, port)
+	config.ParseTime = false
+	config.MultiStatements = true
+	return "mysql://" + config.FormatDSN()
+}
+
+// redactedMySQL renders config without its password, for logging.
+func redactedMySQL(config *mysql.Config) string {
+	redacted := config.Clone()
+	redacted.Passwd = "xxxxx"
+	return redacted.FormatDSN()
+}
+
+func createMySQLDB(pool *dockertest.Pool, network *docker.Network, o *options) (*dockertest.Resource, error) {
+	dbresource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Name:       "db-" + o.runID,
+		Repository: o.mysqlRepo,
+		Tag:        o.mysqlTag,
+		Labels:     o.labels(),
+		Env: []string{
+			"MYSQL_RANDOM_ROOT_PASSWORD=yes",
+			"MYSQL_USER=" + o.dbUser,
+			"MYSQL_PASSWORD=" + o.dbPassword,
+			"MYSQL_DATABASE=" + o.dbDatabase,
+		},
+	}, func(config *docker.HostConfig) {
+		o.hostConfig(config)
+		o.container("db").apply(config)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not start mysql container: %w", err)
+	}
+	o.logs.follow(pool, "db", dbresource)
+	if err := connectNetwork(pool, dbresource, network, o.aliases["db"], o.staticIPs["db"]); err != nil {
+		dbresource.Close()
+		return nil, fmt.Errorf("could not connect mysql container: %w", err)
+	}
+	return dbresource, nil
+}
+
+// waitForMySQL is waitForDB for MySQL. The image's entrypoint creates the
+// database on a server without networking, so the ping only succeeds once
+// the server the tests use is up.
+func waitForMySQL(config *mysql.Config) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		connector, err := mysql.NewConnector(config)
+		if err != nil {
+			return err
+		}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		return db.PingContext(ctx)
+	})
+}
+
+// errPostgresOnly is returned by the LocalTestContainer methods that only
+// work on Postgres when the environment runs WithMySQL.
+var errPostgresOnly = errors.New("not supported with WithMySQL")
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+	"log"
+	"strings"
+	"time"
+)
+
+// mysqlDriver is the database/sql driver name registered by
+// go-sql-driver/mysql. With GOPOS_DB_DRIVER=mysql the app keeps its items in
+// MySQL, see mysqlItemStore; the features only Postgres has, like webhooks,
+// tenants, backups and archiving, are off.
+const mysqlDriver = "mysql"
+
+// usesMySQL reports whether GOPOS_DB_DRIVER selects MySQL.
+func usesMySQL() bool {
+	viper.AutomaticEnv()
+	return viper.GetString("GOPOS_DB_DRIVER") == mysqlDriver
+}
+
+// postgresOnly fails the commands only Postgres supports when
+// GOPOS_DB_DRIVER selects MySQL.
+func postgresOnly(command string) error {
+	if usesMySQL() {
+		return fmt.Errorf("%s needs Postgres, GOPOS_DB_DRIVER is %s", command, mysqlDriver)
+	}
+	return nil
+}
+
+// openMySQL opens the MySQL database of DB_CONN_URL, a go-sql-driver DSN
+// like user:password@tcp(host:3306)/dbname. Times are read as UTC
+// time.Time, and updates report the rows they matched rather than the rows
+// they changed, which checkAffected relies on.
+func openMySQL() (*sql.DB, error) {
+	config, err := mysql.ParseDSN(viper.GetString("DB_CONN_URL"))
+	if err != nil {
+		return nil, err
+	}
+	config.ParseTime = true
+	config.Loc = time.UTC
+	config.ClientFoundRows = true
+	redacted := config.Clone()
+	redacted.Passwd = "xxxxx"
+	log.Println("Connecting to MySQL on url: ", redacted.FormatDSN())
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+const (
+	mysqlListItemsQuery  = "SELECT id, name, price, stock FROM items WHERE deleted_at IS NULL ORDER BY id"
+	mysqlGetItemQuery    = "SELECT id, name, price, stock FROM items WHERE id = ? AND deleted_at IS NULL"
+	mysqlCreateItemQuery = "INSERT INTO items (name, price, stock) VALUES (?, ?, ?)"
+	mysqlUpdateItemQuery = "UPDATE items SET name = ?, price = ?, stock = ? WHERE id = ? AND deleted_at IS NULL"
+	mysqlDeleteItemQuery = "UPDATE items SET deleted_at = UTC_TIMESTAMP(6) WHERE id = ? AND deleted_at IS NULL"
+
+	mysqlLockStockQuery         = "SELECT stock FROM items WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	mysqlTakeStockQuery         = "UPDATE items SET stock = stock - ? WHERE id = ?"
+	mysqlCreateReservationQuery = "INSERT INTO reservations (item_id, quantity, expires_at) VALUES (?, ?, ?)"
+	mysqlExpiredQuery           = "SELECT item_id, sum(quantity), count(*) FROM reservations WHERE expires_at <= ? GROUP BY item_id FOR UPDATE"
+	mysqlReturnStockQuery       = "UPDATE items SET stock = stock + ? WHERE id = ?"
+	mysqlDeleteExpiredQuery     = "DELETE FROM reservations WHERE expires_at <= ?"
+
+	mysqlLockLiveItemQuery = "SELECT 1 FROM items WHERE id = ? AND deleted_at IS NULL FOR SHARE"
+	// LAST_INSERT_ID(id) makes the id of an existing tag the insert's id.
+	mysqlCreateTagQuery = "INSERT INTO tags (name) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)"
+	mysqlTagItemQuery   = "INSERT IGNORE INTO item_tags (item_id, tag_id) VALUES (?, ?)"
+	mysqlUntagItemQuery = `DELETE item_tags FROM item_tags JOIN tags ON tags.id = item_tags.tag_id
+	WHERE item_tags.item_id = ? AND tags.name = ?`
+)
+
+// mysqlItemStore is the ItemStore of GOPOS_DB_DRIVER=mysql, on the schema of
+// db/mysql/migrations. MySQL has no arrays, RETURNING or data-modifying
+// CTEs, so the lists of ids and tags are expanded into placeholders and the
+// multi-table writes run in transactions.
+type mysqlItemStore struct {
+	db *sql.DB
+}
+
+func newMySQLItemStore(db *sql.DB) *mysqlItemStore {
+	return &mysqlItemStore{db: db}
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *mysqlItemStore) ListItems(ctx context.Context) ([]Item, error) {
+	items := []Item{}
+	err := s.EachItem(ctx, func(item Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *mysqlItemStore) EachItem(ctx context.Context, fn func(Item) error) error {
+	return s.eachItem(ctx, fn, mysqlListItemsQuery)
+}
+
+func (s *mysqlItemStore) EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) error {
+	if len(tags) == 0 {
+		return s.EachItem(ctx, fn)
+	}
+	query := `SELECT id, name, price, stock FROM items WHERE deleted_at IS NULL AND id IN (
+		SELECT item_tags.item_id FROM item_tags JOIN tags ON tags.id = item_tags.tag_id
+		WHERE tags.name IN (` + placeholders(len(tags)) + `)
+		GROUP BY item_tags.item_id
+		HAVING count(*) = ?
+	) ORDER BY id`
+	args := make([]any, 0, len(tags)+1)
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	return s.eachItem(ctx, fn, query, append(args, len(tags))...)
+}
+
+func (s *mysqlItemStore) eachItem(ctx context.Context, fn func(Item) error, query string, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Stock); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *mysqlItemStore) GetItem(ctx context.Context, id int) (Item, error) {
+	var item Item
+	err := s.db.QueryRowContext(ctx, mysqlGetItemQuery, id).Scan(&item.ID, &item.Name, &item.Price, &item.Stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, errItemNotFound
+	}
+	return item, err
+}
+
+func (s *mysqlItemStore) GetItems(ctx context.Context, ids []int) ([]Item, error) {
+	items := []Item{}
+	if len(ids) == 0 {
+		return items, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := "SELECT id, name, price, stock FROM items WHERE id IN (" + placeholders(len(ids)) + ") AND deleted_at IS NULL"
+	err := s.eachItem(ctx, func(item Item) error {
+		items = append(items, item)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *mysqlItemStore) CreateItem(ctx context.Context, item Item) (Item, error) {
+	result, err := s.db.ExecContext(ctx, mysqlCreateItemQuery, item.Name, item.Price, item.Stock)
+	if err != nil {
+		return Item{}, err
+	}
+	id, err := result.LastInsertId()
+	item.ID = int(id)
+	return item, err
+}
+
+func (s *mysqlItemStore) UpdateItem(ctx context.Context, id int, item Item) (Item, error) {
+	result, err := s.db.ExecContext(ctx, mysqlUpdateItemQuery, item.Name, item.Price, item.Stock, id)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := checkAffected(result); err != nil {
+		return Item{}, err
+	}
+	item.ID = id
+	return item, nil
+}
+
+func (s *mysqlItemStore) DeleteItem(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, mysqlDeleteItemQuery, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// ReserveItem locks the item's row while checking and taking its stock,
+// like sqlItemStore.ReserveItem.
+func (s *mysqlItemStore) ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (Reservation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	err = tx.QueryRowContext(ctx, mysqlLockStockQuery, id).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reservation{}, errItemNotFound
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+	if stock < quantity {
+		return Reservation{}, errInsufficientStock
+	}
+
+	if _, err := tx.ExecContext(ctx, mysqlTakeStockQuery, quantity, id); err != nil {
+		return Reservation{}, err
+	}
+	result, err := tx.ExecContext(ctx, mysqlCreateReservationQuery, id, quantity, expiresAt.UTC())
+	if err != nil {
+		return Reservation{}, err
+	}
+	reservationID, err := result.LastInsertId()
+	if err != nil {
+		return Reservation{}, err
+	}
+	r := Reservation{ID: int(reservationID), ItemID: id, Quantity: quantity, ExpiresAt: expiresAt}
+	return r, tx.Commit()
+}
+
+func (s *mysqlItemStore) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type expired struct {
+		itemID, quantity int
+	}
+	rows, err := tx.QueryContext(ctx, mysqlExpiredQuery, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	var returns []expired
+	var n int64
+	for rows.Next() {
+		var e expired
+		var count int64
+		if err := rows.Scan(&e.itemID, &e.quantity, &count); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		returns = append(returns, e)
+		n += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range returns {
+		if _, err := tx.ExecContext(ctx, mysqlReturnStockQuery, e.quantity, e.itemID); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, mysqlDeleteExpiredQuery, now.UTC()); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// TagItem holds a shared lock on the item while tagging it, so it can't be
+// deleted in between.
+func (s *mysqlItemStore) TagItem(ctx context.Context, id int, tag string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var live int
+	err = tx.QueryRowContext(ctx, mysqlLockLiveItemQuery, id).Scan(&live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errItemNotFound
+	}
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, mysqlCreateTagQuery, tag)
+	if err != nil {
+		return err
+	}
+	tagID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, mysqlTagItemQuery, id, tagID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlItemStore) UntagItem(ctx context.Context, id int, tag string) error {
+	_, err := s.db.ExecContext(ctx, mysqlUntagItemQuery, id, tag)
+	return err
+}
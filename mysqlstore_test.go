@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// requireMySQL returns a connection to the database of the environment when
+// it runs MySQL, see TEST_DB_ENGINE.
+func requireMySQL(t *testing.T) *sql.DB {
+	t.Helper()
+	requireIntegration(t)
+	if localTestContainer.dbHostMySQL == nil {
+		t.Skip("set TEST_DB_ENGINE=mysql to run the MySQL tests")
+	}
+	db, err := localTestContainer.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestPlaceholders(t *testing.T) {
+	assert.Equal(t, "", placeholders(0))
+	assert.Equal(t, "?", placeholders(1))
+	assert.Equal(t, "?, ?, ?", placeholders(3))
+}
+
+func TestMySQLItemStore(t *testing.T) {
+	store := newMySQLItemStore(requireMySQL(t))
+	ctx := context.Background()
+
+	item, err := store.CreateItem(ctx, Item{Name: "TestMySQLItemStore", Price: 3, Stock: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetItem(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, item, got)
+
+	// Unchanged values still count as found.
+	_, err = store.UpdateItem(ctx, item.ID, item)
+	assert.NoError(t, err)
+	other, err := store.CreateItem(ctx, Item{Name: "TestMySQLItemStore", Price: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := store.GetItems(ctx, []int{item.ID, other.ID, -1})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Item{item, other}, items)
+
+	assert.NoError(t, store.TagItem(ctx, item.ID, "sale"))
+	assert.NoError(t, store.TagItem(ctx, item.ID, "sale"))
+	assert.NoError(t, store.TagItem(ctx, item.ID, "organic"))
+	assert.NoError(t, store.TagItem(ctx, other.ID, "sale"))
+	var tagged []Item
+	assert.NoError(t, store.EachTaggedItem(ctx, []string{"sale", "organic"}, func(i Item) error {
+		tagged = append(tagged, i)
+		return nil
+	}))
+	assert.Equal(t, []Item{item}, tagged)
+	assert.NoError(t, store.UntagItem(ctx, item.ID, "organic"))
+	assert.ErrorIs(t, store.TagItem(ctx, -1, "sale"), errItemNotFound)
+
+	now := time.Now()
+	_, err = store.ReserveItem(ctx, item.ID, 3, now.Add(time.Minute))
+	assert.ErrorIs(t, err, errInsufficientStock)
+	// Already expired, so the sweep doesn't touch the reservations of other
+	// tests sharing the database.
+	r, err := store.ReserveItem(ctx, item.ID, 2, now.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.NotZero(t, r.ID)
+	got, _ = store.GetItem(ctx, item.ID)
+	assert.Equal(t, 0, got.Stock)
+	_, err = store.ExpireReservations(ctx, now)
+	assert.NoError(t, err)
+	got, _ = store.GetItem(ctx, item.ID)
+	assert.Equal(t, 2, got.Stock)
+
+	assert.NoError(t, store.DeleteItem(ctx, item.ID))
+	assert.ErrorIs(t, store.DeleteItem(ctx, item.ID), errItemNotFound)
+	_, err = store.GetItem(ctx, item.ID)
+	assert.ErrorIs(t, err, errItemNotFound)
+	_, err = store.UpdateItem(ctx, item.ID, item)
+	assert.ErrorIs(t, err, errItemNotFound)
+	assert.ErrorIs(t, store.TagItem(ctx, item.ID, "sale"), errItemNotFound)
+}
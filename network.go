@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"log"
+)
+
+// extraNetwork is a network of WithNetwork.
+type extraNetwork struct {
+	name       string
+	containers []string
+}
+
+// WithNetwork creates another network besides the test network and attaches
+// the "db" and "app" containers or sidecars to it under their aliases, e.g.
+// a "backend" network of the app and the database next to a "frontend" one
+// of the app and a proxy. Use DisconnectNetwork to detach a container at run
+// time.
+func WithNetwork(name string, containers ...string) Option {
+	return func(o *options) {
+		for i, n := range o.networks {
+			if n.name == name {
+				o.networks[i].containers = append(n.containers, containers...)
+				return
+			}
+		}
+		o.networks = append(o.networks, extraNetwork{name: name, containers: containers})
+	}
+}
+
+// containerAliases returns the aliases of the "db" or "app" container or a
+// sidecar on the networks it is attached to. A sidecar is always reachable
+// under its name.
+func (o *options) containerAliases(name string) []string {
+	if name == "db" || name == "app" {
+		return o.aliases[name]
+	}
+	return append([]string{name}, o.aliases[name]...)
+}
+
+// createNetworks creates the networks of WithNetwork and returns their IDs by
+// name.
+func createNetworks(pool *dockertest.Pool, o *options) (map[string]string, error) {
+	ids := map[string]string{}
+	for _, n := range o.networks {
+		if n.name == "" {
+			return ids, fmt.Errorf("network without a name")
+		}
+		network, err := pool.Client.CreateNetwork(docker.CreateNetworkOptions{
+			Name:           n.name + "-" + o.runID,
+			Driver:         "bridge",
+			CheckDuplicate: true,
+			Labels:         o.labels(),
+		})
+		if err != nil {
+			return ids, fmt.Errorf("could not create network %s: %w", n.name, err)
+		}
+		ids[n.name] = network.ID
+	}
+	return ids, nil
+}
+
+// attachNetworks connects the containers of the WithNetwork networks once
+// they run.
+func attachNetworks(pool *dockertest.Pool, o *options, ids map[string]string, resources map[string]*dockertest.Resource) error {
+	for _, n := range o.networks {
+		for _, name := range n.containers {
+			resource, ok := resources[name]
+			if !ok {
+				return fmt.Errorf("network %s: no container %s", n.name, name)
+			}
+			err := pool.Client.ConnectNetwork(ids[n.name], docker.NetworkConnectionOptions{
+				Container:      resource.Container.ID,
+				EndpointConfig: &docker.EndpointConfig{Aliases: o.containerAliases(name)},
+			})
+			if err != nil {
+				return fmt.Errorf("could not connect %s to network %s: %w", name, n.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// networkID returns the ID of the network of WithNetwork called name, or of
+// the test network for "".
+func (l LocalTestContainer) networkID(name string) (string, error) {
+	if name == "" {
+		return l.network, nil
+	}
+	id, ok := l.networks[name]
+	if !ok {
+		return "", fmt.Errorf("no network %s", name)
+	}
+	return id, nil
+}
+
+// DisconnectNetwork detaches the "db" or "app" container or a sidecar from
+// the network of WithNetwork called network, or from the test network if it
+// is "", e.g. to test how the app behaves when it loses the database.
+func (l LocalTestContainer) DisconnectNetwork(container string, network string) error {
+	resource, err := l.resource(container)
+	if err != nil {
+		return err
+	}
+	id, err := l.networkID(network)
+	if err != nil {
+		return err
+	}
+	err = l.pool.Client.DisconnectNetwork(id, docker.NetworkConnectionOptions{Container: resource.Container.ID, Force: true})
+	if err != nil {
+		return fmt.Errorf("could not disconnect %s: %w", container, err)
+	}
+	log.Printf("Disconnected %s from network %q", container, network)
+	return nil
+}
+
+// ConnectNetwork attaches a container to a network again after
+// DisconnectNetwork, under its aliases and, on the test network, its
+// WithStaticIP address.
+func (l LocalTestContainer) ConnectNetwork(container string, network string) error {
+	resource, err := l.resource(container)
+	if err != nil {
+		return err
+	}
+	id, err := l.networkID(network)
+	if err != nil {
+		return err
+	}
+	endpoint := &docker.EndpointConfig{Aliases: l.aliases[container]}
+	if ip := l.staticIPs[container]; network == "" && ip != "" {
+		endpoint.IPAMConfig = &docker.EndpointIPAMConfig{IPv4Address: ip}
+	}
+	err = l.pool.Client.ConnectNetwork(id, docker.NetworkConnectionOptions{
+		Container:      resource.Container.ID,
+		EndpointConfig: endpoint,
+	})
+	if err != nil {
+		return fmt.Errorf("could not connect %s: %w", container, err)
+	}
+	log.Printf("Connected %s to network %q", container, network)
+	return nil
+}
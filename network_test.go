@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithNetwork(t *testing.T) {
+	o := defaultOptions()
+	WithNetwork("backend", "app", "db")(o)
+	WithNetwork("frontend", "app")(o)
+	WithNetwork("backend", "redis")(o)
+	assert.Equal(t, []extraNetwork{
+		{name: "backend", containers: []string{"app", "db", "redis"}},
+		{name: "frontend", containers: []string{"app"}},
+	}, o.networks)
+
+	WithNetworkAliases("redis", "cache")(o)
+	assert.Equal(t, []string{"db"}, o.containerAliases("db"))
+	assert.Equal(t, []string{"redis", "cache"}, o.containerAliases("redis"))
+}
+
+func TestDatabasePartition(t *testing.T) {
+	requireIntegration(t)
+	if localTestContainer.composeProject != "" {
+		t.Skip("compose environments have no extra networks")
+	}
+
+	ready := func() bool {
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(localTestContainer.AppBaseURL() + "/readyz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}
+	assert.True(t, ready())
+
+	// The app reaches the database over both networks.
+	var detached []string
+	reconnect := func() {
+		for _, network := range detached {
+			if err := localTestContainer.ConnectNetwork("db", network); err != nil {
+				t.Error(err)
+			}
+		}
+		detached = nil
+	}
+	t.Cleanup(reconnect)
+	for _, network := range []string{"", "backend"} {
+		if err := localTestContainer.DisconnectNetwork("db", network); err != nil {
+			t.Fatal(err)
+		}
+		detached = append(detached, network)
+	}
+	assert.Eventually(t, func() bool { return !ready() }, 30*time.Second, time.Second)
+
+	reconnect()
+	assert.Eventually(t, ready, 60*time.Second, time.Second)
+}
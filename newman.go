@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// NewmanCase is one request of a Postman collection run, with the messages
+// of its failed assertions.
+type NewmanCase struct {
+	Suite    string
+	Name     string
+	Failures []string
+}
+
+// RunNewman runs the Postman collection file in a Newman container against
+// the app and returns the results from its JUnit report. An error means the
+// collection could not be run, not that assertions failed.
+func (l LocalTestContainer) RunNewman(collection string) ([]NewmanCase, error) {
+	baseURL := fmt.Sprintf("http://%s:8000", l.appAlias)
+	resource, err := l.pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postman/newman",
+		Tag:        "alpine",
+		NetworkID:  l.network,
+		Labels:     runLabels(l.RunID, l.expiry),
+		// Wait for the collection to be copied in.
+		Entrypoint: []string{"sh", "-c", waitForUpload("/etc/newman", `exec newman "$@"`), "newman"},
+		Cmd: []string{"run", path.Join("/etc/newman", filepath.Base(collection)),
+			"--env-var", "baseUrl=" + baseURL,
+			"--reporters", "cli,junit",
+			"--reporter-junit-export", "/tmp/junit.xml"},
+	}, func(config *docker.HostConfig) {
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not start newman: %w", err)
+	}
+	defer resource.Close()
+	if err := uploadDir(l.pool, resource.Container.ID, collection, "/etc/newman"); err != nil {
+		return nil, fmt.Errorf("could not copy %s: %w", collection, err)
+	}
+
+	// Newman exits non-zero when assertions fail, which the report covers.
+	if _, err := l.pool.Client.WaitContainer(resource.Container.ID); err != nil {
+		return nil, err
+	}
+
+	report, err := readFromContainer(l.pool, resource.Container.ID, "/tmp/junit.xml")
+	if err != nil {
+		var logs strings.Builder
+		_ = l.pool.Client.Logs(docker.LogsOptions{
+			Container:    resource.Container.ID,
+			OutputStream: &logs,
+			ErrorStream:  &logs,
+			Stdout:       true,
+			Stderr:       true,
+		})
+		return nil, fmt.Errorf("newman wrote no report: %w\n%s", err, logs.String())
+	}
+	return parseJUnit(report)
+}
+
+type junitReport struct {
+	Suites []struct {
+		Name  string `xml:"name,attr"`
+		Cases []struct {
+			Name     string `xml:"name,attr"`
+			Failures []struct {
+				Message string `xml:"message,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"failure"`
+			Errors []struct {
+				Message string `xml:"message,attr"`
+				Text    string `xml:",chardata"`
+			} `xml:"error"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+// parseJUnit reads the test cases from a JUnit XML report.
+func parseJUnit(data []byte) ([]NewmanCase, error) {
+	var report junitReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid JUnit report: %w", err)
+	}
+
+	var cases []NewmanCase
+	for _, suite := range report.Suites {
+		for _, tc := range suite.Cases {
+			c := NewmanCase{Suite: suite.Name, Name: tc.Name}
+			for _, f := range append(tc.Failures, tc.Errors...) {
+				msg := f.Message
+				if msg == "" {
+					msg = strings.TrimSpace(f.Text)
+				}
+				c.Failures = append(c.Failures, msg)
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostmanCollections(t *testing.T) {
+	requireIntegration(t)
+
+	collections, err := filepath.Glob("postman/*.postman_collection.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, collection := range collections {
+		t.Run(filepath.Base(collection), func(t *testing.T) {
+			t.Parallel()
+
+			cases, err := localTestContainer.RunNewman(collection)
+			if err != nil {
+				t.Fatalf("Failed to run collection: %v", err)
+			}
+			if len(cases) == 0 {
+				t.Fatal("The collection ran no requests")
+			}
+			for _, c := range cases {
+				for _, failure := range c.Failures {
+					t.Errorf("%s / %s: %s", c.Suite, c.Name, failure)
+				}
+			}
+		})
+	}
+}
+
+func TestParseJUnit(t *testing.T) {
+	cases, err := parseJUnit([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="gopos" tests="2">
+  <testsuite name="Health" tests="1">
+    <testcase name="status is ok"/>
+  </testsuite>
+  <testsuite name="Get item" tests="1">
+    <testcase name="item is returned">
+      <failure type="AssertionFailure" message="expected response to have status code 200 but got 404"/>
+    </testcase>
+  </testsuite>
+</testsuites>`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []NewmanCase{
+		{Suite: "Health", Name: "status is ok"},
+		{Suite: "Get item", Name: "item is returned", Failures: []string{"expected response to have status code 200 but got 404"}},
+	}, cases)
+
+	_, err = parseJUnit([]byte("not xml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,330 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pactProvider is the name consumers use for this service in their pacts.
+const pactProvider = "gopos"
+
+type pact struct {
+	Consumer struct {
+		Name string `json:"name"`
+	} `json:"consumer"`
+	Interactions []pactInteraction `json:"interactions"`
+}
+
+type pactInteraction struct {
+	Description    string              `json:"description"`
+	ProviderState  string              `json:"providerState"`
+	ProviderStates []pactProviderState `json:"providerStates"`
+	Request        struct {
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Query   string            `json:"query"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status        int               `json:"status"`
+		Headers       map[string]string `json:"headers"`
+		Body          json.RawMessage   `json:"body"`
+		MatchingRules json.RawMessage   `json:"matchingRules"`
+	} `json:"response"`
+}
+
+type pactProviderState struct {
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params"`
+}
+
+// providerStates set up the data a consumer expects before an interaction is
+// replayed. Keys are matched against the state name; submatches are passed to
+// the handler.
+var providerStates = map[*regexp.Regexp]func(t *testing.T, db *sql.DB, args []string){
+	regexp.MustCompile(`^an item with id (\d+) exists$`): func(t *testing.T, db *sql.DB, args []string) {
+		id, _ := strconv.Atoi(args[0])
+		_, err := db.Exec(`INSERT INTO items (id, name, price) VALUES ($1, 'Espresso', 250)
+			ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, price = EXCLUDED.price`, id)
+		if err != nil {
+			t.Fatalf("Failed to set up provider state: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Exec("DELETE FROM items WHERE id = $1", id)
+		})
+	},
+	regexp.MustCompile(`^no item with id (\d+) exists$`): func(t *testing.T, db *sql.DB, args []string) {
+		if _, err := db.Exec("DELETE FROM items WHERE id = $1", args[0]); err != nil {
+			t.Fatalf("Failed to set up provider state: %v", err)
+		}
+	},
+}
+
+// TestPactProvider replays every consumer interaction against the running
+// app. Pacts are read from PACT_BROKER_URL when set, otherwise from PACT_DIR
+// (default ./pacts).
+func TestPactProvider(t *testing.T) {
+	requirePostgres(t)
+
+	pacts, err := loadPacts()
+	if err != nil {
+		t.Fatalf("Failed to load pacts: %v", err)
+	}
+	if len(pacts) == 0 {
+		t.Skip("no pacts to verify")
+	}
+
+	db, err := localTestContainer.DB()
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	for _, p := range pacts {
+		for _, interaction := range p.Interactions {
+			t.Run(p.Consumer.Name+"/"+interaction.Description, func(t *testing.T) {
+				for _, state := range interaction.states() {
+					setProviderState(t, db, state)
+				}
+				verifyInteraction(t, interaction)
+			})
+		}
+	}
+}
+
+func (i pactInteraction) states() []string {
+	var states []string
+	if i.ProviderState != "" {
+		states = append(states, i.ProviderState)
+	}
+	for _, s := range i.ProviderStates {
+		states = append(states, s.Name)
+	}
+	return states
+}
+
+func setProviderState(t *testing.T, db *sql.DB, state string) {
+	t.Helper()
+	for pattern, handler := range providerStates {
+		if m := pattern.FindStringSubmatch(state); m != nil {
+			handler(t, db, m[1:])
+			return
+		}
+	}
+	t.Fatalf("No handler for provider state %q", state)
+}
+
+func verifyInteraction(t *testing.T, interaction pactInteraction) {
+	url := client.baseURL + interaction.Request.Path
+	if interaction.Request.Query != "" {
+		url += "?" + interaction.Request.Query
+	}
+
+	var body io.Reader
+	if len(interaction.Request.Body) > 0 {
+		body = bytes.NewReader(interaction.Request.Body)
+	}
+	req, err := http.NewRequest(interaction.Request.Method, url, body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	for k, v := range interaction.Request.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, interaction.Response.Status, resp.StatusCode)
+	for k, v := range interaction.Response.Headers {
+		assert.Equal(t, v, resp.Header.Get(k), "header %s", k)
+	}
+
+	if len(interaction.Response.Body) == 0 {
+		return
+	}
+	var expected, actual any
+	if err := json.Unmarshal(interaction.Response.Body, &expected); err != nil {
+		t.Fatalf("Invalid expected body: %v", err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&actual); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	typeMatched := typeMatchedPaths(interaction.Response.MatchingRules)
+	for _, mismatch := range pactMismatches("$", expected, actual, typeMatched) {
+		t.Error(mismatch)
+	}
+}
+
+// typeMatchedPaths returns the body paths (as "$.a.b") that only need to match
+// by type, from either pact v2 or v3 matching rules.
+func typeMatchedPaths(raw json.RawMessage) map[string]bool {
+	paths := map[string]bool{}
+	if len(raw) == 0 {
+		return paths
+	}
+
+	var v2 map[string]struct {
+		Match string `json:"match"`
+	}
+	if json.Unmarshal(raw, &v2) == nil {
+		for path, rule := range v2 {
+			if rule.Match == "type" && strings.HasPrefix(path, "$.body") {
+				paths["$"+strings.TrimPrefix(path, "$.body")] = true
+			}
+		}
+	}
+
+	var v3 struct {
+		Body map[string]struct {
+			Matchers []struct {
+				Match string `json:"match"`
+			} `json:"matchers"`
+		} `json:"body"`
+	}
+	if json.Unmarshal(raw, &v3) == nil {
+		for path, rule := range v3.Body {
+			for _, m := range rule.Matchers {
+				if m.Match == "type" {
+					paths[path] = true
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// pactMismatches compares actual against expected the way pact does: objects
+// may carry extra keys, everything else must be equal unless the path only
+// requires a type match.
+func pactMismatches(path string, expected, actual any, typeMatched map[string]bool) []string {
+	if typeMatched[path] {
+		if reflect.TypeOf(expected) != reflect.TypeOf(actual) {
+			return []string{fmt.Sprintf("%s: expected a %T, got %#v", path, expected, actual)}
+		}
+		return nil
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %#v", path, actual)}
+		}
+		var mismatches []string
+		for k, v := range e {
+			mismatches = append(mismatches, pactMismatches(path+"."+k, v, a[k], typeMatched)...)
+		}
+		return mismatches
+	case []any:
+		a, ok := actual.([]any)
+		if !ok || len(a) != len(e) {
+			return []string{fmt.Sprintf("%s: expected %d elements, got %#v", path, len(e), actual)}
+		}
+		var mismatches []string
+		for i := range e {
+			mismatches = append(mismatches, pactMismatches(fmt.Sprintf("%s[%d]", path, i), e[i], a[i], typeMatched)...)
+		}
+		return mismatches
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return []string{fmt.Sprintf("%s: expected %#v, got %#v", path, expected, actual)}
+		}
+		return nil
+	}
+}
+
+func loadPacts() ([]pact, error) {
+	if broker := os.Getenv("PACT_BROKER_URL"); broker != "" {
+		return fetchPacts(strings.TrimSuffix(broker, "/"))
+	}
+
+	dir := os.Getenv("PACT_DIR")
+	if dir == "" {
+		dir = "./pacts"
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pacts []pact
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var p pact
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		pacts = append(pacts, p)
+	}
+	return pacts, nil
+}
+
+// fetchPacts downloads the latest pact of every consumer of this provider
+// from a pact broker.
+func fetchPacts(broker string) ([]pact, error) {
+	var index struct {
+		Links struct {
+			Pacts []struct {
+				Href string `json:"href"`
+			} `json:"pb:pacts"`
+		} `json:"_links"`
+	}
+	if err := getBrokerJSON(fmt.Sprintf("%s/pacts/provider/%s/latest", broker, pactProvider), &index); err != nil {
+		return nil, err
+	}
+
+	var pacts []pact
+	for _, link := range index.Links.Pacts {
+		var p pact
+		if err := getBrokerJSON(link.Href, &p); err != nil {
+			return nil, err
+		}
+		pacts = append(pacts, p)
+	}
+	return pacts, nil
+}
+
+func getBrokerJSON(url string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if user := os.Getenv("PACT_BROKER_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("PACT_BROKER_PASSWORD"))
+	}
+	if token := os.Getenv("PACT_BROKER_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
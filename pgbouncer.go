@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"strconv"
+)
+
+const pgbouncerImage = "edoburu/pgbouncer:v1.23.1-p2"
+
+// pgbouncerPort is where PgBouncer listens on the test network.
+const pgbouncerPort = "5432"
+
+// WithPgBouncer puts a PgBouncer in poolMode, "session", "transaction" or
+// "statement", between the app and Postgres, so the suite covers what
+// connection pooling breaks, e.g. prepared statements and session state
+// with transaction pooling. With WithToxiproxy, PgBouncer connects through
+// the proxy. The migrations and the tests' own connections go to Postgres
+// directly; PgBouncerDSN connects through it.
+func WithPgBouncer(poolMode string) Option {
+	return func(o *options) {
+		switch poolMode {
+		case "session", "transaction", "statement":
+		default:
+			o.errs = append(o.errs, fmt.Errorf("pgbouncer: unknown pool mode %q", poolMode))
+			return
+		}
+		o.pgbouncer = poolMode
+		o.addSidecar(sidecar{
+			name:  "pgbouncer",
+			image: pgbouncerImage,
+			start: createPgBouncer,
+		})
+	}
+}
+
+// createPgBouncer starts PgBouncer in front of Postgres, or of Toxiproxy
+// when it runs too, and waits until it accepts connections.
+func createPgBouncer(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+	return startService(ctx, pool, network, o, host, "pgbouncer", ServiceSpec{
+		Image: pgbouncerImage,
+		Env:   pgbouncerEnv(o),
+		Ports: []string{pgbouncerPort},
+		Wait:  WaitSpec{TCP: pgbouncerPort},
+	})
+}
+
+// pgbouncerEnv configures the PgBouncer image.
+func pgbouncerEnv(o *options) map[string]string {
+	upstream, port := o.aliases["db"][0], "5432"
+	if o.toxiproxy {
+		upstream, port = "toxiproxy", toxiproxyDBPort
+	}
+	env := map[string]string{
+		"DB_HOST":     upstream,
+		"DB_PORT":     port,
+		"DB_USER":     o.dbUser,
+		"DB_PASSWORD": o.dbPassword,
+		"DB_NAME":     o.dbDatabase,
+		"AUTH_TYPE":   "scram-sha-256",
+		"POOL_MODE":   o.pgbouncer,
+		"LISTEN_PORT": pgbouncerPort,
+		// Protocol-level prepared statements, which pgx uses, survive
+		// transaction pooling since PgBouncer 1.21 only with this set.
+		"MAX_PREPARED_STATEMENTS": "100",
+		// The app sets statement_timeout in its connection string, which
+		// PgBouncer refuses as a startup parameter unless it tracks it.
+		"TRACK_EXTRA_PARAMETERS": "statement_timeout",
+	}
+	if o.postgresTLS {
+		env["SERVER_TLS_SSLMODE"] = "require"
+	}
+	return env
+}
+
+// pgbouncerDSN returns the connection string of PgBouncer at host and port.
+// The app's side of PgBouncer has no TLS, only its side of Postgres.
+func (o *options) pgbouncerDSN(host string, port string) DSN {
+	dsn := o.testDSN(host, port)
+	dsn.SSLMode = "disable"
+	return dsn
+}
+
+// PgBouncerDSN returns the connection string of the PgBouncer of
+// WithPgBouncer, for tests checking pooling behavior themselves.
+func (l LocalTestContainer) PgBouncerDSN() (DSN, error) {
+	resource, ok := l.services["pgbouncer"]
+	if !ok {
+		return DSN{}, fmt.Errorf("no service pgbouncer, see WithPgBouncer")
+	}
+	port, _ := strconv.Atoi(resource.GetPort(pgbouncerPort + "/tcp"))
+	dsn := l.dbHostDSN
+	dsn.Host = l.Host
+	dsn.Port = port
+	dsn.SSLMode = "disable"
+	dsn.SSLRootCert = ""
+	return dsn, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWithPgBouncer(t *testing.T) {
+	o := defaultOptions()
+	WithPgBouncer("transaction")(o)
+	assert.Equal(t, "transaction", o.pgbouncer)
+	assert.Len(t, o.sidecars, 1)
+	assert.Equal(t, "disable", o.pgbouncerDSN("pgbouncer", pgbouncerPort).SSLMode)
+	env := pgbouncerEnv(o)
+	assert.Equal(t, "transaction", env["POOL_MODE"])
+	assert.Equal(t, "statement_timeout", env["TRACK_EXTRA_PARAMETERS"])
+	assert.Equal(t, "db", env["DB_HOST"])
+	WithToxiproxy()(o)
+	assert.Equal(t, "toxiproxy", pgbouncerEnv(o)["DB_HOST"])
+
+	o = defaultOptions()
+	WithPgBouncer("per-query")(o)
+	assert.Empty(t, o.sidecars)
+	assert.Len(t, o.errs, 1)
+}
+
+func TestPgBouncer(t *testing.T) {
+	requireIntegration(t)
+	if !localTestContainer.hasService("pgbouncer") {
+		t.Skip("set TEST_PGBOUNCER to a pool mode to put PgBouncer between the app and Postgres")
+	}
+
+	// The app connects through PgBouncer with its statement_timeout, and its
+	// prepared statements survive its connections being shared.
+	for i := 0; i < 10; i++ {
+		item := factory.Item(t)
+		client.GetItem(t, item.ID)
+	}
+
+	dsn, err := localTestContainer.PgBouncerDSN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dsn.SetStatementTimeout(1500 * time.Millisecond)
+	db, err := sql.Open(dbDriver, dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+	stmt, err := db.Prepare("SELECT count(*) FROM items WHERE id > $1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for i := 0; i < 20; i++ {
+		var n int
+		assert.NoError(t, stmt.QueryRow(0).Scan(&n))
+	}
+	var timeout string
+	assert.NoError(t, db.QueryRow("SHOW statement_timeout").Scan(&timeout))
+	assert.Equal(t, "1500ms", timeout)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	Plans        []planNode `json:"Plans"`
+}
+
+// assertIndexScan fails when the plan of query reads a table with a
+// sequential scan. Test tables are too small for the planner to prefer an
+// index, so sequential scans are disabled while planning: one still showing
+// up means no index can serve the query.
+func assertIndexScan(t testing.TB, query string, args ...any) {
+	t.Helper()
+	db := requireTestDB(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SET LOCAL enable_seqscan = off"); err != nil {
+		t.Fatal(err)
+	}
+	var out string
+	if err := tx.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&out); err != nil {
+		t.Fatalf("Failed to explain %q: %v", query, err)
+	}
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		t.Fatalf("Invalid plan: %v", err)
+	}
+
+	var seqScans []string
+	for _, p := range plans {
+		walkPlan(p.Plan, func(n planNode) {
+			if n.NodeType == "Seq Scan" {
+				seqScans = append(seqScans, n.RelationName)
+			}
+		})
+	}
+	if len(seqScans) > 0 {
+		t.Errorf("%q scans %s sequentially:\n%s", query, strings.Join(seqScans, ", "), out)
+	}
+}
+
+func walkPlan(n planNode, fn func(planNode)) {
+	fn(n)
+	for _, child := range n.Plans {
+		walkPlan(child, fn)
+	}
+}
+
+func TestQueryPlans(t *testing.T) {
+	t.Parallel()
+
+	for name, q := range map[string]struct {
+		query string
+		args  []any
+	}{
+		"list":                {listItemsQuery, nil},
+		"get":                 {getItemQuery, []any{1}},
+		"get many":            {getItemsQuery, []any{[]int{1, 2}}},
+		"update":              {updateItemQuery, []any{"name", 1, 1}},
+		"delete":              {deleteItemQuery, []any{1}},
+		"lock stock":          {lockStockQuery, []any{1}},
+		"expire reservations": {expireReservationsQuery, []any{time.Now()}},
+		"untag":               {untagItemQuery, []any{1, "sale"}},
+		"tagged":              {taggedItemsQuery, []any{[]string{"sale", "organic"}, 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assertIndexScan(t, q.query, q.args...)
+		})
+	}
+}
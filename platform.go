@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"strings"
+)
+
+// WithPlatform builds the app image for platform, e.g. "linux/amd64", instead
+// of the daemon's own, to test a platform the daemon only emulates.
+func WithPlatform(platform string) Option {
+	return func(o *options) {
+		o.platform = platform
+	}
+}
+
+// daemonPlatform returns the platform of the daemon, e.g. "linux/arm64" on
+// Apple Silicon, so the app image builds natively rather than emulated.
+func daemonPlatform(pool *dockertest.Pool) (string, error) {
+	info, err := pool.Client.Info()
+	if err != nil {
+		return "", fmt.Errorf("could not get the daemon info: %w", err)
+	}
+	osType := info.OSType
+	if osType == "" {
+		osType = "linux"
+	}
+	return osType + "/" + goArch(info.Architecture), nil
+}
+
+// goArch maps the machine names daemons report, as uname -m does, to
+// GOARCH.
+func goArch(machine string) string {
+	switch strings.ToLower(machine) {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "armv7l", "armv6l", "arm":
+		return "arm"
+	case "i386", "i686", "386":
+		return "386"
+	}
+	return machine
+}
+
+// platformArch returns the architecture of a platform like "linux/arm64/v8".
+func platformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return platform
+	}
+	return parts[1]
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPlatform(t *testing.T) {
+	for machine, arch := range map[string]string{
+		"x86_64":  "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"armv7l":  "arm",
+		"s390x":   "s390x",
+	} {
+		assert.Equal(t, arch, goArch(machine), machine)
+	}
+	assert.Equal(t, "arm64", platformArch("linux/arm64/v8"))
+	assert.Equal(t, "amd64", platformArch("linux/amd64"))
+
+	o := defaultOptions()
+	assert.Empty(t, o.platform)
+	WithPlatform("linux/amd64")(o)
+	assert.Equal(t, "linux/amd64", o.platform)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithPodman treats the container engine as Podman even when it doesn't
+// say so. Podman is detected on its own otherwise.
+func WithPodman() Option {
+	return func(o *options) {
+		o.podman = true
+	}
+}
+
+// dockerEndpoint returns the endpoint of the container engine, "" for
+// dockertest's default of DOCKER_HOST or the Docker socket. Without either,
+// it looks for the socket of a rootless, then a rootful Podman, so the
+// suite runs on machines with only Podman installed.
+func dockerEndpoint() string {
+	if os.Getenv("DOCKER_HOST") != "" || os.Getenv("DOCKER_URL") != "" {
+		return ""
+	}
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		return ""
+	}
+	var sockets []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	sockets = append(sockets, "/run/podman/podman.sock")
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return ""
+}
+
+// isPodman tells whether the engine behind pool is Podman, which reports
+// itself as a component of its Docker compatible version.
+func isPodman(pool *dockertest.Pool) (bool, error) {
+	version, err := pool.Client.Version()
+	if err != nil {
+		return false, fmt.Errorf("could not get the engine version: %w", err)
+	}
+	return strings.Contains(version.Get("Components"), "Podman"), nil
+}
+
+// hostConfig applies the settings every container of the environment
+// shares. Podman removes an auto-removed container as soon as it exits,
+// which races with dockertest inspecting it after the start, so under
+// Podman the containers are left to Close to remove.
+func (o *options) hostConfig(config *docker.HostConfig) {
+	config.NetworkMode = "bridge"
+	config.AutoRemove = !o.podman
+	config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDockerEndpoint(t *testing.T) {
+	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
+		t.Skip("Docker is installed, so the Podman socket is never used")
+	}
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_URL", "")
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	socket := filepath.Join(dir, "podman", "podman.sock")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socket), 0o700))
+	assert.NoError(t, os.WriteFile(socket, nil, 0o600))
+	assert.Equal(t, "unix://"+socket, dockerEndpoint())
+
+	t.Setenv("DOCKER_HOST", "tcp://build:2376")
+	assert.Equal(t, "", dockerEndpoint())
+}
+
+func TestPodmanHostConfig(t *testing.T) {
+	o := defaultOptions()
+	config := &docker.HostConfig{}
+	o.hostConfig(config)
+	assert.True(t, config.AutoRemove)
+	assert.Equal(t, "bridge", config.NetworkMode)
+
+	WithPodman()(o)
+	o.hostConfig(config)
+	assert.False(t, config.AutoRemove)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+const rabbitMQImage = "rabbitmq:3.13-management-alpine"
+
+// The user, password and vhost the RabbitMQ broker is set up with.
+const (
+	rabbitMQUser     = "gopos"
+	rabbitMQPassword = "secret"
+	rabbitMQVHost    = "gopos"
+)
+
+// WithRabbitMQ starts a RabbitMQ broker with its management UI on the test
+// network and points the app at it with AMQP_URL. Use RabbitMQURL to reach
+// it from the tests.
+func WithRabbitMQ() Option {
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:   "rabbitmq",
+			image:  rabbitMQImage,
+			appEnv: []string{"AMQP_URL=" + rabbitMQURL("rabbitmq:5672")},
+			start:  createRabbitMQ,
+		})
+	}
+}
+
+func rabbitMQURL(addr string) string {
+	return fmt.Sprintf("amqp://%s:%s@%s/%s", rabbitMQUser, rabbitMQPassword, addr, rabbitMQVHost)
+}
+
+// createRabbitMQ starts the broker and waits until it accepts AMQP
+// connections.
+func createRabbitMQ(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+	return startService(ctx, pool, network, o, host, "rabbitmq", ServiceSpec{
+		Image: rabbitMQImage,
+		Env: map[string]string{
+			"RABBITMQ_DEFAULT_USER":  rabbitMQUser,
+			"RABBITMQ_DEFAULT_PASS":  rabbitMQPassword,
+			"RABBITMQ_DEFAULT_VHOST": rabbitMQVHost,
+		},
+		Ports: []string{"5672", "15672"},
+		waits: []WaitStrategy{WaitForExec("rabbitmq-diagnostics", "-q", "check_port_connectivity")},
+	})
+}
+
+// RabbitMQURL returns the AMQP URL the tests reach the WithRabbitMQ broker
+// at.
+func (l LocalTestContainer) RabbitMQURL() (string, error) {
+	addr, err := l.ServiceAddr("rabbitmq", "5672")
+	if err != nil {
+		return "", err
+	}
+	return rabbitMQURL(addr), nil
+}
+
+// RabbitMQManagementURL returns the URL of the broker's management UI and
+// HTTP API, which take the same credentials.
+func (l LocalTestContainer) RabbitMQManagementURL() (string, error) {
+	addr, err := l.ServiceAddr("rabbitmq", "15672")
+	if err != nil {
+		return "", err
+	}
+	return "http://" + addr, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"github.com/ory/dockertest/v3/docker"
+	"strings"
+)
+
+const raceSeparator = "=================="
+
+// DataRaces returns every data race report the app container has logged so
+// far. It only finds anything when the app was built WithRaceDetector.
+func (l LocalTestContainer) DataRaces() ([]string, error) {
+	var logs bytes.Buffer
+	err := l.pool.Client.Logs(docker.LogsOptions{
+		Container:    l.appcontainer.Container.ID,
+		OutputStream: &logs,
+		ErrorStream:  &logs,
+		Stdout:       true,
+		Stderr:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseDataRaces(logs.String()), nil
+}
+
+// parseDataRaces extracts the reports the race detector writes between
+// separator lines.
+func parseDataRaces(logs string) []string {
+	var races []string
+	for _, segment := range strings.Split(logs, raceSeparator) {
+		segment = strings.TrimSpace(segment)
+		if strings.HasPrefix(segment, "WARNING: DATA RACE") {
+			races = append(races, segment)
+		}
+	}
+	return races
+}
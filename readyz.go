@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Version is set at build time with -ldflags "-X main.Version=...".
+var Version = "dev"
+
+// started is when the process started, for the uptime in /readyz.
+var started = time.Now()
+
+// buildCommit returns the VCS revision the binary was built from, if Go
+// recorded it.
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// getReadiness reports whether the app can serve requests: the database is
+// reachable and migrated to the schema this binary expects. The response
+// identifies the binary and the schema, so one call shows what is running.
+func (g GoPOS) getReadiness(c *gin.Context) {
+	body := gin.H{
+		"status":                  "ready",
+		"version":                 Version,
+		"commit":                  buildCommit(),
+		"go_version":              runtime.Version(),
+		"uptime_seconds":          int(time.Since(started).Seconds()),
+		"expected_schema_version": schemaVersion,
+	}
+	if g.db == nil {
+		// Served from memory in tests, there is no schema. On MySQL, db wait
+		// checked it before the app started.
+		c.JSON(http.StatusOK, body)
+		return
+	}
+
+	version, dirty, err := schemaState(g.db)
+	if err == nil {
+		body["schema_version"] = version
+		body["schema_dirty"] = dirty
+		err = checkSchema(g.db, schemaVersion)
+	}
+	if err != nil {
+		body["status"] = "not ready"
+		body["error"] = err.Error()
+		c.JSON(http.StatusServiceUnavailable, body)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	var body map[string]any
+	client.Request(t, http.MethodGet, "/readyz", nil, http.StatusOK, &body)
+
+	assert.Equal(t, "ready", body["status"])
+	assert.Equal(t, Version, body["version"])
+	assert.Contains(t, body, "commit")
+	assert.GreaterOrEqual(t, body["uptime_seconds"], float64(0))
+	assert.EqualValues(t, schemaVersion, body["expected_schema_version"])
+	// MySQL's schema is checked by db wait only.
+	if integrationEnv && localTestContainer.dbHostMySQL == nil {
+		assert.EqualValues(t, schemaVersion, body["schema_version"])
+		assert.Equal(t, false, body["schema_dirty"])
+	}
+}
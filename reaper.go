@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"log"
+	"strconv"
+	"time"
+)
+
+// The labels of the containers, networks and images of an environment.
+const (
+	// runLabel is the run ID of the environment.
+	runLabel = "gopos.run"
+	// expiresLabel is when the reaper may remove the container or network,
+	// in Unix seconds.
+	expiresLabel = "gopos.expires"
+)
+
+const defaultExpiry = time.Hour
+
+// WithExpiry sets how long the containers and networks of the environment
+// may live. Close removes them; when a test binary crashes before it could,
+// the next environment started on the same daemon removes them once they
+// have expired. Suites running longer than the default hour need more.
+func WithExpiry(expiry time.Duration) Option {
+	return func(o *options) {
+		o.expiry = expiry
+	}
+}
+
+// labels returns the labels of a container or network of the environment,
+// expiring the expiry of o from now.
+func (o *options) labels() map[string]string {
+	return runLabels(o.runID, o.expiry)
+}
+
+func runLabels(runID string, expiry time.Duration) map[string]string {
+	return map[string]string{
+		runLabel:     runID,
+		expiresLabel: strconv.FormatInt(time.Now().Add(expiry).Unix(), 10),
+	}
+}
+
+// expired reports whether the labels of a container or network carry an
+// expiry before now.
+func expired(labels map[string]string, now time.Time) bool {
+	expires, err := strconv.ParseInt(labels[expiresLabel], 10, 64)
+	return err == nil && now.Unix() > expires
+}
+
+// reapExpired removes the containers and then the networks of earlier runs
+// that have expired. It only logs what it couldn't remove: another run may
+// be reaping the same ones.
+func reapExpired(pool *dockertest.Pool) {
+	now := time.Now()
+	err := reap(pool, false, func(labels map[string]string) bool {
+		return expired(labels, now)
+	})
+	if err != nil {
+		log.Printf("Reaper: %s", err)
+	}
+}
+
+// reap removes the labelled containers, networks and, with images, images
+// match selects by their labels, in that order so nothing still uses what is
+// removed.
+func reap(pool *dockertest.Pool, images bool, match func(labels map[string]string) bool) error {
+	var errs []error
+	containers, err := pool.Client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {runLabel}},
+	})
+	if err != nil {
+		return fmt.Errorf("could not list containers: %w", err)
+	}
+	for _, c := range containers {
+		if !match(c.Labels) {
+			continue
+		}
+		err := pool.Client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID, Force: true, RemoveVolumes: true})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not remove container %s of run %s: %w", c.ID, c.Labels[runLabel], err))
+			continue
+		}
+		log.Printf("Removed container %s of run %s", c.ID, c.Labels[runLabel])
+	}
+
+	networks, err := pool.Client.FilteredListNetworks(docker.NetworkFilterOpts{"label": {runLabel: true}})
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("could not list networks: %w", err))...)
+	}
+	for _, n := range networks {
+		if !match(n.Labels) {
+			continue
+		}
+		if err := pool.Client.RemoveNetwork(n.ID); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove network %s of run %s: %w", n.Name, n.Labels[runLabel], err))
+			continue
+		}
+		log.Printf("Removed network %s of run %s", n.Name, n.Labels[runLabel])
+	}
+
+	if !images {
+		return errors.Join(errs...)
+	}
+	list, err := pool.Client.ListImages(docker.ListImagesOptions{Filters: map[string][]string{"label": {runLabel}}})
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("could not list images: %w", err))...)
+	}
+	for _, image := range list {
+		if !match(image.Labels) {
+			continue
+		}
+		if err := pool.Client.RemoveImageExtended(image.ID, docker.RemoveImageOptions{Force: true}); err != nil {
+			errs = append(errs, fmt.Errorf("could not remove image %s: %w", image.ID, err))
+			continue
+		}
+		log.Printf("Removed image %s %v", image.ID, image.RepoTags)
+	}
+	return errors.Join(errs...)
+}
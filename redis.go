@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+const redisImage = "redis:7-alpine"
+
+// WithRedis starts a Redis on the test network and points the app at it
+// with REDIS_URL, for testing caching.
+func WithRedis() Option {
+	return func(o *options) {
+		o.addSidecar(sidecar{
+			name:   "redis",
+			image:  redisImage,
+			appEnv: []string{"REDIS_URL=redis://redis:6379/0"},
+			start:  createRedis,
+		})
+	}
+}
+
+// createRedis starts Redis and waits until it answers PING.
+func createRedis(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+	return startService(ctx, pool, network, o, host, "redis", ServiceSpec{
+		Image: redisImage,
+		Ports: []string{"6379"},
+		waits: []WaitStrategy{waitForExecOutput("PONG", "redis-cli", "ping")},
+	})
+}
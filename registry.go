@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ory/dockertest/v3/docker"
+	"strings"
+)
+
+// WithRegistryAuth logs in to registry, e.g. "registry.internal:5000", with
+// auth when pulling images or building the app image from base images it
+// hosts. It takes precedence over the docker config.
+func WithRegistryAuth(registry string, auth docker.AuthConfiguration) Option {
+	return func(o *options) {
+		if o.registryAuths == nil {
+			o.registryAuths = map[string]docker.AuthConfiguration{}
+		}
+		o.registryAuths[registryHost(registry)] = auth
+	}
+}
+
+// WithDockerConfig reads the registry credentials of a docker config.json
+// at path instead of $DOCKER_CONFIG/config.json or ~/.docker/config.json.
+// Credential helpers aren't supported, only the auths it stores.
+func WithDockerConfig(path string) Option {
+	return func(o *options) {
+		auths, err := docker.NewAuthConfigurationsFromFile(path)
+		if err != nil {
+			o.errs = append(o.errs, fmt.Errorf("docker config %s: %w", path, err))
+			return
+		}
+		o.dockerConfig = auths
+	}
+}
+
+// auths returns the registry credentials of the environment, by registry
+// host: those of WithRegistryAuth over those of the docker config.
+func (o *options) auths() docker.AuthConfigurations {
+	config := o.dockerConfig
+	if config == nil {
+		// Without a docker config, images are pulled anonymously.
+		config, _ = docker.NewAuthConfigurationsFromDockerCfg()
+	}
+	auths := docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{}}
+	if config != nil {
+		for registry, auth := range config.Configs {
+			auths.Configs[registryHost(registry)] = auth
+		}
+	}
+	for registry, auth := range o.registryAuths {
+		auths.Configs[registry] = auth
+	}
+	return auths
+}
+
+// dockerHub is the registry of images without one.
+const dockerHub = "docker.io"
+
+// dockerHubIndex is how the daemon names Docker Hub when it looks up the
+// credentials of a build.
+const dockerHubIndex = "https://index.docker.io/v1/"
+
+// buildAuths returns auths keyed as the daemon looks them up for the base
+// images of a build.
+func buildAuths(auths docker.AuthConfigurations) docker.AuthConfigurations {
+	keyed := docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{}}
+	for registry, auth := range auths.Configs {
+		if registry == dockerHub {
+			registry = dockerHubIndex
+		}
+		keyed.Configs[registry] = auth
+	}
+	return keyed
+}
+
+// registryHost returns the host of a registry as written in a docker config
+// or an image, e.g. "https://index.docker.io/v1/" is docker.io.
+func registryHost(registry string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHub
+	}
+	return host
+}
+
+// imageRegistry returns the registry host of a repository, docker.io for
+// one without a registry like "postgres" or "migrate/migrate".
+func imageRegistry(repository string) string {
+	first, _, ok := strings.Cut(repository, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+	return dockerHub
+}
+
+// authFor returns the credentials to pull repository with, empty when
+// there are none.
+func authFor(auths docker.AuthConfigurations, repository string) docker.AuthConfiguration {
+	return auths.Configs[imageRegistry(repository)]
+}
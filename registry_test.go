@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageRegistry(t *testing.T) {
+	for repository, registry := range map[string]string{
+		"postgres":                      "docker.io",
+		"migrate/migrate":               "docker.io",
+		"registry.internal/postgres":    "registry.internal",
+		"registry.internal:5000/mirror": "registry.internal:5000",
+		"localhost/postgres":            "localhost",
+	} {
+		assert.Equal(t, registry, imageRegistry(repository), repository)
+	}
+	assert.Equal(t, "docker.io", registryHost("https://index.docker.io/v1/"))
+	assert.Equal(t, "registry.internal:5000", registryHost("https://registry.internal:5000"))
+}
+
+func TestRegistryAuth(t *testing.T) {
+	dir := t.TempDir()
+	// user:secret and mirror:pw
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "dXNlcjpzZWNyZXQ="},
+		"registry.internal": {"auth": "bWlycm9yOnB3"}
+	}}`
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	o := defaultOptions()
+	WithDockerConfig(path)(o)
+	WithRegistryAuth("registry.internal", docker.AuthConfiguration{Username: "ci", Password: "token"})(o)
+	assert.Empty(t, o.errs)
+	auths := o.auths()
+	assert.Equal(t, "user", authFor(auths, "postgres").Username)
+	// WithRegistryAuth wins over the docker config.
+	assert.Equal(t, "ci", authFor(auths, "registry.internal/postgres").Username)
+	assert.Empty(t, authFor(auths, "quay.io/minio/minio").Username)
+
+	keyed := buildAuths(auths)
+	assert.Equal(t, "user", keyed.Configs[dockerHubIndex].Username)
+	assert.Equal(t, "ci", keyed.Configs["registry.internal"].Username)
+
+	o = defaultOptions()
+	WithDockerConfig(filepath.Join(dir, "missing.json"))(o)
+	assert.Len(t, o.errs, 1)
+}
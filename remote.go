@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// dockerHost returns the address the ports the containers publish are
+// reachable at: the daemon's host when it is remote (DOCKER_HOST, with TLS
+// from DOCKER_CERT_PATH), localhost otherwise.
+func dockerHost(pool *dockertest.Pool) string {
+	u, err := url.Parse(pool.Client.Endpoint())
+	if err != nil {
+		return "localhost"
+	}
+	switch u.Scheme {
+	case "tcp", "http", "https":
+		if host := u.Hostname(); host != "" {
+			return host
+		}
+	}
+	return "localhost"
+}
+
+// readyMarker is uploaded after the files of a directory, so a container
+// can wait for the upload to complete.
+const readyMarker = ".ready"
+
+// uploadDir copies the files of the local directory dir, or the file dir,
+// to the directory dest of a running container, followed by readyMarker.
+// Unlike a bind mount, this works when the daemon runs on another machine.
+func uploadDir(pool *dockertest.Pool, containerID string, dir string, dest string) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeTar(tw, dir, dest); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: path.Join(path.Clean(dest)[1:], readyMarker), Mode: 0o644}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return pool.Client.UploadToContainer(containerID, docker.UploadToContainerOptions{
+		InputStream: &buf,
+		Path:        "/",
+	})
+}
+
+// writeTar writes the files of the local directory dir, or the file dir, to
+// tw as if they were in the absolute directory dest.
+func writeTar(tw *tar.Writer, dir string, dest string) error {
+	base := dir
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		base = filepath.Dir(dir)
+	}
+	root := path.Clean(dest)[1:]
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(root, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0o755})
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: int64(len(content))}); err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	})
+}
+
+// waitForUpload prefixes a container's shell command with waiting for an
+// uploadDir to dest.
+func waitForUpload(dest string, command string) string {
+	return "until [ -e " + path.Join(dest, readyMarker) + " ]; do sleep 0.1; done && " + command
+}
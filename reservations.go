@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+)
+
+// defaultReservationTTL is how long a reservation holds stock when the
+// request doesn't say.
+const defaultReservationTTL = 15 * time.Minute
+
+// Reservation holds stock of an item for a pending order until it expires.
+type Reservation struct {
+	ID        int       `json:"id"`
+	ItemID    int       `json:"item_id"`
+	Quantity  int       `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type reservationRequest struct {
+	Quantity   int `json:"quantity" binding:"required,min=1"`
+	TTLSeconds int `json:"ttl_seconds" binding:"min=0"`
+}
+
+func (g *GoPOS) createReservation(c *gin.Context) {
+	id, ok := itemID(c)
+	if !ok {
+		return
+	}
+	var req reservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := defaultReservationTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	reservation, err := g.store.ReserveItem(c.Request.Context(), id, req.Quantity, g.now().Add(ttl).UTC())
+	if errors.Is(err, errInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient stock"})
+		return
+	}
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// expireReservations returns the stock of reservations expired on clock
+// every interval until ctx is done. An interval of zero or less disables
+// the sweep.
+func expireReservations(ctx context.Context, store ItemStore, clock Clock, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("Reservation sweep disabled, expired reservations keep their stock")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := store.ExpireReservations(ctx, clock.Now())
+			if err != nil {
+				log.Printf("Could not expire reservations: %s", err)
+			} else if n > 0 {
+				log.Printf("Expired %d reservations", n)
+			}
+		}
+	}
+}
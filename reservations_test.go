@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCreateReservation(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t, withStock(5))
+	path := fmt.Sprintf("/items/%d/reservations", item.ID)
+
+	var r Reservation
+	client.Request(t, http.MethodPost, path, reservationRequest{Quantity: 3}, http.StatusCreated, &r)
+	assert.Equal(t, item.ID, r.ItemID)
+	assert.Equal(t, 3, r.Quantity)
+	assert.WithinDuration(t, time.Now().Add(defaultReservationTTL), r.ExpiresAt, time.Minute)
+	assert.Equal(t, 2, client.GetItem(t, item.ID).Stock)
+
+	client.Request(t, http.MethodPost, path, reservationRequest{Quantity: 3}, http.StatusConflict, nil)
+	client.Request(t, http.MethodPost, path, reservationRequest{Quantity: 0}, http.StatusBadRequest, nil)
+	client.Request(t, http.MethodPost, "/items/0/reservations", reservationRequest{Quantity: 1}, http.StatusNotFound, nil)
+}
+
+// TestConcurrentReservations checks that terminals racing for the last units
+// can't oversell them.
+func TestConcurrentReservations(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t, withStock(10))
+	path := fmt.Sprintf("/items/%d/reservations", item.ID)
+
+	statuses := stress(t, 25, func(i int) (int, error) {
+		status, _, err := client.Send(http.MethodPost, path, reservationRequest{Quantity: 1})
+		return status, err
+	})
+
+	assert.Equal(t, 10, countStatus(statuses, http.StatusCreated))
+	assert.Equal(t, 15, countStatus(statuses, http.StatusConflict))
+	assert.Equal(t, 0, client.GetItem(t, item.ID).Stock)
+}
+
+func TestExpireReservations(t *testing.T) {
+	store := newMemItemStore()
+	ctx := context.Background()
+	item, _ := store.CreateItem(ctx, Item{Name: "TestExpireReservations", Stock: 4})
+	now := time.Now()
+
+	_, err := store.ReserveItem(ctx, item.ID, 3, now.Add(time.Minute))
+	assert.NoError(t, err)
+	_, err = store.ReserveItem(ctx, item.ID, 2, now.Add(time.Minute))
+	assert.ErrorIs(t, err, errInsufficientStock)
+
+	n, err := store.ExpireReservations(ctx, now)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	n, err = store.ExpireReservations(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	item, _ = store.GetItem(ctx, item.ID)
+	assert.Equal(t, 4, item.Stock)
+}
+
+func TestExpireReservationsDisabled(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		done := make(chan struct{})
+		go func() {
+			expireReservations(context.Background(), newMemItemStore(), systemClock{}, interval)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Sweep with interval %s did not return", interval)
+		}
+	}
+}
+
+func TestSQLReservations(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLItemStore(requireTestDB(t))
+	ctx := context.Background()
+	item, err := store.CreateItem(ctx, Item{Name: "TestSQLReservations", Price: 1, Stock: 2})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(ctx, item.ID)
+	})
+
+	// Expired right away, so the sweep below returns the stock.
+	_, err = store.ReserveItem(ctx, item.ID, 2, time.Now().Add(-time.Second))
+	assert.NoError(t, err)
+	_, err = store.ReserveItem(ctx, item.ID, 1, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, errInsufficientStock)
+
+	n, err := store.ExpireReservations(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, n, int64(1))
+	fetched, err := store.GetItem(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetched.Stock)
+}
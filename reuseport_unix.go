@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// reusePort lets several processes bind the same address, so a new instance
+// can start serving before the old one has drained.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		if sockErr == nil {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scenario is an end-to-end flow described in testdata/scenarios/*.yaml.
+// Values captured from one step's response can be used in later steps as
+// ${name}.
+type scenario struct {
+	Name  string         `yaml:"name"`
+	Steps []scenarioStep `yaml:"steps"`
+}
+
+type scenarioStep struct {
+	Name    string `yaml:"name"`
+	Request struct {
+		Method string `yaml:"method"`
+		Path   string `yaml:"path"`
+		Body   any    `yaml:"body"`
+	} `yaml:"request"`
+	Expect struct {
+		Status int `yaml:"status"`
+		// Body lists fields the JSON response object must contain.
+		Body map[string]any `yaml:"body"`
+	} `yaml:"expect"`
+	// Capture maps variable names to fields of the JSON response object.
+	Capture map[string]string `yaml:"capture"`
+}
+
+var scenarioVar = regexp.MustCompile(`\$\{(\w+)\}`)
+
+func TestScenarios(t *testing.T) {
+	for _, s := range loadScenarios(t) {
+		t.Run(s.Name, func(t *testing.T) {
+			t.Parallel()
+			runScenario(t, client, s)
+		})
+	}
+}
+
+// TestScenariosSQLStore runs the scenarios against the SQL store without
+// the containers, so a store behaving unlike the in-memory one fails here
+// too, e.g. with TEST_DB_BACKEND=embedded.
+func TestScenariosSQLStore(t *testing.T) {
+	db, _ := requireIsolatedDB(t)
+	server := httptest.NewServer(newStoreRouter(newSQLItemStore(db)))
+	defer server.Close()
+	c := newAPIClient(server.URL)
+	for _, s := range loadScenarios(t) {
+		t.Run(s.Name, func(t *testing.T) {
+			runScenario(t, c, s)
+		})
+	}
+}
+
+func loadScenarios(t *testing.T) []scenario {
+	files, err := filepath.Glob("testdata/scenarios/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scenarios []scenario
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s scenario
+		if err := yaml.Unmarshal(data, &s); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		if s.Name == "" {
+			s.Name = strings.TrimSuffix(filepath.Base(file), ".yaml")
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios
+}
+
+func runScenario(t *testing.T, client *apiClient, s scenario) {
+	vars := map[string]any{}
+	for i, step := range s.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i+1)
+		}
+
+		path := expandVars(t, step.Request.Path, vars).(string)
+		status, body := client.Do(t, step.Request.Method, path, expandVars(t, step.Request.Body, vars))
+		if step.Expect.Status != 0 && status != step.Expect.Status {
+			t.Fatalf("%s: %s %s returned %d, want %d: %s", name, step.Request.Method, path, status, step.Expect.Status, body)
+		}
+		if len(step.Expect.Body) == 0 && len(step.Capture) == 0 {
+			continue
+		}
+
+		var got map[string]any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("%s: response is not a JSON object: %s", name, body)
+		}
+		for field, want := range step.Expect.Body {
+			want = normalizeJSON(t, expandVars(t, want, vars))
+			if !reflect.DeepEqual(got[field], want) {
+				t.Errorf("%s: field %q = %v, want %v", name, field, got[field], want)
+			}
+		}
+		for v, field := range step.Capture {
+			value, ok := got[field]
+			if !ok {
+				t.Fatalf("%s: cannot capture %q, response has no field %q: %s", name, v, field, body)
+			}
+			vars[v] = value
+		}
+	}
+}
+
+// expandVars replaces ${name} references in strings. A string that is only
+// a reference takes the captured value's type, so ids stay numbers.
+func expandVars(t *testing.T, v any, vars map[string]any) any {
+	switch v := v.(type) {
+	case string:
+		if m := scenarioVar.FindStringSubmatch(v); m != nil && m[0] == v {
+			return lookupVar(t, m[1], vars)
+		}
+		return scenarioVar.ReplaceAllStringFunc(v, func(ref string) string {
+			return fmt.Sprint(lookupVar(t, scenarioVar.FindStringSubmatch(ref)[1], vars))
+		})
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = expandVars(t, e, vars)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = expandVars(t, e, vars)
+		}
+		return out
+	}
+	return v
+}
+
+func lookupVar(t *testing.T, name string, vars map[string]any) any {
+	value, ok := vars[name]
+	if !ok {
+		t.Fatalf("Undefined scenario variable %q", name)
+	}
+	return value
+}
+
+// normalizeJSON converts a value decoded from YAML to the types
+// encoding/json decodes into, so it can be compared with a response.
+func normalizeJSON(t *testing.T, v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// schemaQueries describe the public schema, excluding the migration
+// bookkeeping, one line per column, index and constraint.
+var schemaQueries = []string{
+	`SELECT format('column %s.%s %s nullable=%s default=%s', table_name, column_name, data_type, is_nullable, coalesce(column_default, ''))
+	FROM information_schema.columns
+	WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+	ORDER BY table_name, column_name`,
+	`SELECT format('index %s', indexdef)
+	FROM pg_indexes
+	WHERE schemaname = 'public' AND tablename <> 'schema_migrations'
+	ORDER BY indexname`,
+	`SELECT format('constraint %s.%s %s', conrelid::regclass, conname, pg_get_constraintdef(oid))
+	FROM pg_constraint
+	WHERE connamespace = 'public'::regnamespace AND conrelid::regclass::text <> 'schema_migrations'
+		-- Postgres 18+ lists NOT NULL as constraints; the columns already cover them.
+		AND contype <> 'n'
+	ORDER BY conrelid::regclass::text, conname`,
+}
+
+// schemaSnapshot renders the public schema of db as sorted text lines, so two
+// schemas can be compared with diffLines.
+func schemaSnapshot(db *sql.DB) (string, error) {
+	var lines []string
+	for _, q := range schemaQueries {
+		rows, err := db.Query(q)
+		if err != nil {
+			return "", err
+		}
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				rows.Close()
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// diffLines lists the lines only in expected ("-") or only in actual ("+"),
+// or returns "" when both hold the same lines.
+func diffLines(expected, actual string) string {
+	count := map[string]int{}
+	for _, l := range strings.Split(expected, "\n") {
+		if l != "" {
+			count[l]--
+		}
+	}
+	for _, l := range strings.Split(actual, "\n") {
+		if l != "" {
+			count[l]++
+		}
+	}
+
+	var diff []string
+	for _, l := range strings.Split(expected+"\n"+actual, "\n") {
+		switch n := count[l]; {
+		case n < 0:
+			diff = append(diff, fmt.Sprintf("- %s", l))
+		case n > 0:
+			diff = append(diff, fmt.Sprintf("+ %s", l))
+		default:
+			continue
+		}
+		count[l] = 0
+	}
+	return strings.Join(diff, "\n")
+}
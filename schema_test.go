@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// schemaSnapshotFile is the committed schema the migrations must produce.
+const schemaSnapshotFile = "testdata/schema.txt"
+
+// TestSchemaDrift fails when the migrated test database differs from the
+// committed snapshot, e.g. after a migration was changed without updating
+// the snapshot or the schema was altered by hand. Run with -update to
+// rewrite the snapshot.
+func TestSchemaDrift(t *testing.T) {
+	db := requireTestDB(t)
+
+	actual, err := schemaSnapshot(db)
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+
+	if *update {
+		if err := os.WriteFile(schemaSnapshotFile, []byte(actual+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to update schema snapshot: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(schemaSnapshotFile)
+	if err != nil {
+		t.Fatalf("Failed to read schema snapshot: %v", err)
+	}
+	if diff := diffLines(string(expected), actual); diff != "" {
+		t.Errorf("Schema differs from %s (run with -update if the change is intended):\n%s", schemaSnapshotFile, diff)
+	}
+}
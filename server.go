@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// server is one listener the app serves on, e.g. the public API or the
+// admin/metrics endpoint.
+type server struct {
+	name string
+	// network is "tcp" (the default) or "unix".
+	network string
+	addr    string
+	// mode sets the permissions of a unix socket file.
+	mode os.FileMode
+	// reusePort binds a tcp address with SO_REUSEPORT.
+	reusePort bool
+	// ln, when set, is an already open listener (e.g. from systemd) used
+	// instead of binding addr.
+	ln      net.Listener
+	handler http.Handler
+}
+
+// runServers starts every server and blocks until ctx is cancelled or one of
+// them fails, then gracefully shuts all of them down.
+func runServers(ctx context.Context, servers []server) error {
+	viper.SetDefault("GOPOS_SHUTDOWN_TIMEOUT", 10*time.Second)
+	shutdownTimeout := viper.GetDuration("GOPOS_SHUTDOWN_TIMEOUT")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	httpServers := make([]*http.Server, 0, len(servers))
+	errs := make(chan error, len(servers))
+	for _, s := range servers {
+		ln, err := s.listen()
+		if err != nil {
+			cancel()
+			shutdown(httpServers, shutdownTimeout)
+			return fmt.Errorf("%s listener: %w", s.name, err)
+		}
+
+		srv := &http.Server{Handler: s.handler}
+		httpServers = append(httpServers, srv)
+		log.Printf("Serving %s on %s", s.name, ln.Addr())
+
+		go func(name string) {
+			err := srv.Serve(ln)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			} else if err != nil {
+				err = fmt.Errorf("%s listener: %w", name, err)
+			}
+			errs <- err
+			cancel()
+		}(s.name)
+	}
+
+	<-ctx.Done()
+	shutdown(httpServers, shutdownTimeout)
+
+	var err error
+	for range httpServers {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+func (s server) listen() (net.Listener, error) {
+	if s.ln != nil {
+		return s.ln, nil
+	}
+	if s.network != "unix" {
+		lc := net.ListenConfig{}
+		if s.reusePort {
+			lc.Control = reusePort
+		}
+		return lc.Listen(context.Background(), "tcp", s.addr)
+	}
+
+	// A previous instance that crashed leaves the socket file behind. Any
+	// other file at the path is a misconfiguration, left for listen to fail
+	// on rather than deleted.
+	info, err := os.Lstat(s.addr)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && info.Mode().Type() == os.ModeSocket {
+		if err := os.Remove(s.addr); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.mode != 0 {
+		if err := os.Chmod(s.addr, s.mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+func shutdown(servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Could not shut down server gracefully: %s", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopos.sock")
+	// A stale socket file from a crashed instance must not block startup.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := server{network: "unix", addr: path, mode: 0660}.listen()
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+}
+
+func TestServerListenUnixKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gopos.sock")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+
+	_, err := server{network: "unix", addr: path}.listen()
+	assert.Error(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestServerListenReusePort(t *testing.T) {
+	first, err := server{addr: "127.0.0.1:0", reusePort: true}.listen()
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer first.Close()
+
+	second, err := server{addr: first.Addr().String(), reusePort: true}.listen()
+	if err != nil {
+		t.Fatalf("Failed to bind the same port twice: %v", err)
+	}
+	second.Close()
+}
+
+func TestRunServersShutsDownOnCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- runServers(ctx, []server{{name: "api", ln: ln, handler: handler}})
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("servers did not shut down")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"strings"
+)
+
+// sidecar is a service the app depends on, started once the database is up
+// and before the app. It is reachable on the test network under its name.
+type sidecar struct {
+	name string
+	// image is pulled in the pull phase, as repository[:tag].
+	image string
+	// deps are the sidecars that must be up before this one starts.
+	deps []string
+	// appEnv is added to the app container's environment.
+	appEnv []string
+	start  func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error)
+}
+
+// addSidecar adds a sidecar, replacing one of the same name so repeating an
+// option doesn't start a service twice.
+func (o *options) addSidecar(s sidecar) {
+	for i := range o.sidecars {
+		if o.sidecars[i].name == s.name {
+			o.sidecars[i] = s
+			return
+		}
+	}
+	o.sidecars = append(o.sidecars, s)
+}
+
+// topologySidecars adds the services of the topology, in start order.
+func (o *options) topologySidecars(t *Topology) {
+	for _, name := range t.order {
+		name, spec := name, t.Services[name]
+		o.addSidecar(sidecar{
+			name:  name,
+			image: spec.Image,
+			deps:  serviceDeps(spec),
+			start: func(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+				return startService(ctx, pool, network, o, host, name, spec)
+			},
+		})
+	}
+}
+
+// execOK runs cmd in resource, failing unless it exits 0.
+func execOK(resource *dockertest.Resource, cmd ...string) error {
+	var out bytes.Buffer
+	code, err := resource.Exec(cmd, dockertest.ExecOptions{StdOut: &out, StdErr: &out})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("%s exited with %d: %s", strings.Join(cmd, " "), code, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// templateDatabase is the name of the snapshot of the migrated database
+// that ResetDatabase restores.
+func templateDatabase(database string) string {
+	return database + "_template"
+}
+
+// createTemplate copies the database of dsn, freshly migrated and without
+// connections, into its template database. The template doesn't accept
+// connections, so nothing keeps it from being copied back.
+func createTemplate(ctx context.Context, dsn DSN) error {
+	db, err := adminDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	template := templateDatabase(dsn.DBName)
+	if _, err := db.ExecContext(ctx, "CREATE DATABASE "+template+" TEMPLATE "+dsn.DBName); err != nil {
+		return fmt.Errorf("could not create template database: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "ALTER DATABASE "+template+" ALLOW_CONNECTIONS false"); err != nil {
+		return fmt.Errorf("could not create template database: %w", err)
+	}
+	return nil
+}
+
+// adminDB connects to the postgres database next to the database of dsn,
+// to create and drop it.
+func adminDB(dsn DSN) (*sql.DB, error) {
+	dsn.DBName = "postgres"
+	return sql.Open(dbDriver, dsn.String())
+}
+
+// ResetDatabase puts the database back to how it was right after the
+// migrations, by dropping it and copying it from the template taken then.
+// It takes milliseconds instead of re-running the migrations. The app's
+// open connections are closed; it reconnects on its next query.
+func (l LocalTestContainer) ResetDatabase() error {
+	if l.dbHostMySQL != nil {
+		return errPostgresOnly
+	}
+	if !l.template {
+		return errors.New("the environment has no template database")
+	}
+	db, err := adminDB(l.dbHostDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	start := time.Now()
+	database := l.dbHostDSN.DBName
+	if _, err := db.Exec("DROP DATABASE " + database + " WITH (FORCE)"); err != nil {
+		return fmt.Errorf("could not drop database: %w", err)
+	}
+	if _, err := db.Exec("CREATE DATABASE " + database + " TEMPLATE " + templateDatabase(database)); err != nil {
+		return fmt.Errorf("could not restore database: %w", err)
+	}
+	log.Printf("Reset database %s in %s", database, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// TruncateAll empties every table but the migrations' own, restarting their
+// sequences, e.g. in t.Cleanup so the rows a test created don't show up in
+// the next test's assertions. Unlike ResetDatabase, the app keeps its
+// connections. Tests running in parallel lose their rows too.
+func (l LocalTestContainer) TruncateAll() error {
+	if l.dbHostMySQL != nil {
+		return errPostgresOnly
+	}
+	db, err := sql.Open(dbDriver, l.DBConnString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT quote_ident(schemaname) || '.' || quote_ident(tablename) FROM pg_tables
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema') AND tablename <> 'schema_migrations'
+		ORDER BY 1`)
+	if err != nil {
+		return fmt.Errorf("could not list tables: %w", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	if _, err := db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+		return fmt.Errorf("could not truncate tables: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestResetDatabase(t *testing.T) {
+	requirePostgres(t)
+	if !localTestContainer.template {
+		t.Skip("compose environments have no template database")
+	}
+	item := factory.Item(t)
+
+	// Resetting drops every row, so this test must not run in parallel.
+	if err := localTestContainer.ResetDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	// The app's first query may still hit a connection the reset closed.
+	retryFlaky(t, 3, func(t testing.TB) {
+		status, _ := client.Do(t, http.MethodGet, fmt.Sprintf("/items/%d", item.ID), nil)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	// The schema is back at the migrated version and the app reconnected.
+	var body map[string]any
+	client.Request(t, http.MethodGet, "/readyz", nil, http.StatusOK, &body)
+	assert.EqualValues(t, schemaVersion, body["schema_version"])
+	client.GetItem(t, factory.Item(t).ID)
+}
+
+func TestTruncateAll(t *testing.T) {
+	requirePostgres(t)
+	// Truncating drops every row, so this test must not run in parallel.
+	t.Cleanup(func() {
+		if err := localTestContainer.TruncateAll(); err != nil {
+			t.Error(err)
+		}
+	})
+	factory.Item(t)
+	factory.Item(t)
+
+	if err := localTestContainer.TruncateAll(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, client.GetItems(t))
+	// The sequences restart too.
+	assert.Equal(t, 1, factory.Item(t).ID)
+}
+
+func TestTemplateDatabase(t *testing.T) {
+	assert.Equal(t, "dbname_template", templateDatabase("dbname"))
+}
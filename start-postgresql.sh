@@ -8,4 +8,4 @@ docker run \
   -e POSTGRES_USER=$(cat secrets/db.user) \
   -e POSTGRES_DB=$(cat secrets/db.name) \
   -p 5432:5432 \
-  -d postgres:latest
\ No newline at end of file
+  -d postgres:16.4-alpine
\ No newline at end of file
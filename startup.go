@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The phases of starting the environment, each bounded by its own timeout.
+const (
+	// PhasePull pulls the images that aren't present yet.
+	PhasePull = "pull"
+	// PhaseBuild builds the app image.
+	PhaseBuild = "build"
+	// PhaseMigrate waits for the migrations to apply.
+	PhaseMigrate = "migrate"
+	// PhaseHealth waits for the database and then the app to answer.
+	PhaseHealth = "health"
+)
+
+var defaultPhaseTimeouts = map[string]time.Duration{
+	PhasePull:    5 * time.Minute,
+	PhaseBuild:   10 * time.Minute,
+	PhaseMigrate: time.Minute,
+	PhaseHealth:  3 * time.Minute,
+}
+
+// WithPhaseTimeout bounds a startup phase, e.g.
+// WithPhaseTimeout(PhaseBuild, 15*time.Minute) on a slow CI runner.
+func WithPhaseTimeout(phase string, timeout time.Duration) Option {
+	return func(o *options) {
+		o.phaseTimeouts[phase] = timeout
+	}
+}
+
+// phase returns a context for running phase, cancelled when its timeout
+// runs out or ctx is.
+func (o *options) phase(ctx context.Context, phase string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, o.phaseTimeouts[phase])
+}
+
+// retry calls fn with exponential backoff until it succeeds or ctx is done,
+// like dockertest's Pool.Retry but cancellable.
+func retry(ctx context.Context, fn func() error) error {
+	wait := 100 * time.Millisecond
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		if wait < 5*time.Second {
+			wait *= 2
+		}
+	}
+}
+
+// pullImages pulls the images, given as repository[:tag], that aren't
+// present yet, with the credentials of their registries in auths.
+func pullImages(ctx context.Context, pool *dockertest.Pool, images []string, auths docker.AuthConfigurations) error {
+	for _, image := range images {
+		repository, tag := splitImage(image)
+		if err := pullImage(ctx, pool, repository, tag, authFor(auths, repository)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullProgressInterval is how often a pull logs its progress.
+const pullProgressInterval = 10 * time.Second
+
+// pullImage pulls repository:tag unless it is already present, as
+// Pool.RunWithOptions would, but cancellable and logging its progress, so a
+// first run pulling large images doesn't look stuck.
+func pullImage(ctx context.Context, pool *dockertest.Pool, repository string, tag string, auth docker.AuthConfiguration) error {
+	image := repository + ":" + tag
+	if _, err := pool.Client.InspectImage(image); err == nil {
+		return nil
+	}
+	log.Printf("Pulling %s", image)
+	start := time.Now()
+	progress := &pullProgress{layers: map[string]pullLayer{}}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(pullProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Printf("Pulling %s: %s after %s", image, progress, time.Since(start).Round(time.Second))
+			}
+		}
+	}()
+	err := pool.Client.PullImage(docker.PullImageOptions{
+		Repository:    repository,
+		Tag:           tag,
+		Context:       ctx,
+		OutputStream:  progress,
+		RawJSONStream: true,
+	}, auth)
+	if err == nil {
+		// In a raw stream the daemon reports a failed pull as a message.
+		err = progress.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("could not pull %s: %w", image, err)
+	}
+	log.Printf("Pulled %s in %s", image, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// pullProgress follows the JSON messages of a pull and sums the download
+// progress of its layers. It keeps the first error the daemon reports.
+type pullProgress struct {
+	mu     sync.Mutex
+	buf    []byte
+	layers map[string]pullLayer
+	err    error
+}
+
+type pullLayer struct {
+	current, total int64
+}
+
+func (p *pullProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.message(p.buf[:i])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// message follows one JSON message of the pull.
+func (p *pullProgress) message(line []byte) {
+	var msg struct {
+		ID             string `json:"id"`
+		Status         string `json:"status"`
+		ProgressDetail struct {
+			Current int64 `json:"current"`
+			Total   int64 `json:"total"`
+		} `json:"progressDetail"`
+		Error       string `json:"error"`
+		ErrorDetail struct {
+			Message string `json:"message"`
+		} `json:"errorDetail"`
+	}
+	if json.Unmarshal(line, &msg) != nil {
+		return
+	}
+	if msg.Error != "" || msg.ErrorDetail.Message != "" {
+		if p.err == nil {
+			if msg.ErrorDetail.Message != "" {
+				msg.Error = msg.ErrorDetail.Message
+			}
+			p.err = errors.New(msg.Error)
+		}
+		return
+	}
+	// The first message names the tag, not a layer.
+	if msg.ID == "" || strings.HasPrefix(msg.Status, "Pulling from") {
+		return
+	}
+	layer := p.layers[msg.ID]
+	switch msg.Status {
+	case "Downloading":
+		layer = pullLayer{current: msg.ProgressDetail.Current, total: msg.ProgressDetail.Total}
+	case "Download complete", "Pull complete", "Already exists":
+		layer.current = layer.total
+	}
+	p.layers[msg.ID] = layer
+}
+
+// Err returns the error the daemon reported for the pull, if any, once the
+// stream has ended.
+func (p *pullProgress) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(bytes.TrimSpace(p.buf)) > 0 {
+		p.message(p.buf)
+		p.buf = nil
+	}
+	return p.err
+}
+
+// String returns the downloaded and total size of the layers seen so far.
+func (p *pullProgress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var current, total int64
+	for _, layer := range p.layers {
+		current += layer.current
+		total += layer.total
+	}
+	return fmt.Sprintf("%d/%d MB of %d layers", current>>20, total>>20, len(p.layers))
+}
+
+// buildImage builds the image name from the build options, as
+// Pool.BuildAndRunWithBuildOptions would, but cancellable and labelled,
+// writing the build output to out. auths are the credentials of the
+// registries of its base images.
+func buildImage(ctx context.Context, pool *dockertest.Pool, name string, out io.Writer, build *dockertest.BuildOptions, labels map[string]string, auths docker.AuthConfigurations) error {
+	err := pool.Client.BuildImage(docker.BuildImageOptions{
+		Name:         name,
+		Labels:       labels,
+		AuthConfigs:  auths,
+		Dockerfile:   build.Dockerfile,
+		OutputStream: out,
+		ContextDir:   build.ContextDir,
+		BuildArgs:    build.BuildArgs,
+		Platform:     build.Platform,
+		Context:      ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("could not build %s: %w", name, err)
+	}
+	return nil
+}
+
+// WaitForApp waits until the app answers /health, or the "app" strategies
+// of WithWaitStrategy are ready, for at most the health phase timeout.
+func (l LocalTestContainer) WaitForApp(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, l.healthTimeout)
+	defer cancel()
+
+	target := WaitTarget{Pool: l.pool, Resource: l.appcontainer, Host: l.Host}
+	if err := waitFor(ctx, target, l.appWait, WaitForHTTP("8000", "/health")); err != nil {
+		return fmt.Errorf("the app didn't become healthy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	errItemNotFound      = errors.New("item not found")
+	errInsufficientStock = errors.New("insufficient stock")
+)
+
+// ItemStore persists items. Lookups of missing items return errItemNotFound.
+type ItemStore interface {
+	ListItems(ctx context.Context) ([]Item, error)
+	// EachItem calls fn for every item as it is read, stopping at the first
+	// error, so callers don't need to hold the whole catalog in memory.
+	EachItem(ctx context.Context, fn func(Item) error) error
+	GetItem(ctx context.Context, id int) (Item, error)
+	// GetItems returns the items with the given ids in one query, in no
+	// particular order. Missing ids are left out rather than failing.
+	GetItems(ctx context.Context, ids []int) ([]Item, error)
+	CreateItem(ctx context.Context, item Item) (Item, error)
+	UpdateItem(ctx context.Context, id int, item Item) (Item, error)
+	DeleteItem(ctx context.Context, id int) error
+	// ReserveItem takes quantity out of the item's stock until expiresAt,
+	// failing with errInsufficientStock when not enough is left.
+	ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (Reservation, error)
+	// ExpireReservations returns the stock of reservations expired at now
+	// and reports how many there were.
+	ExpireReservations(ctx context.Context, now time.Time) (int64, error)
+	// TagItem attaches tag to the item, creating the tag on first use.
+	TagItem(ctx context.Context, id int, tag string) error
+	// UntagItem detaches tag from the item. Detaching a tag the item
+	// doesn't have is not an error.
+	UntagItem(ctx context.Context, id int, tag string) error
+	// EachTaggedItem is EachItem limited to the items having all of tags.
+	EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) error
+}
+
+const (
+	listItemsQuery  = "SELECT id, name, price, stock FROM items WHERE deleted_at IS NULL ORDER BY id"
+	getItemQuery    = "SELECT id, name, price, stock FROM items WHERE id = $1 AND deleted_at IS NULL"
+	getItemsQuery   = "SELECT id, name, price, stock FROM items WHERE id = ANY($1) AND deleted_at IS NULL"
+	createItemQuery = "INSERT INTO items (name, price, stock) VALUES ($1, $2, $3) RETURNING id"
+	updateItemQuery = "UPDATE items SET name = $1, price = $2, stock = $3 WHERE id = $4 AND deleted_at IS NULL"
+	// Deleted items are kept until the archiver moves them to items_archive.
+	deleteItemQuery = "UPDATE items SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL"
+
+	lockStockQuery          = "SELECT stock FROM items WHERE id = $1 AND deleted_at IS NULL FOR UPDATE"
+	takeStockQuery          = "UPDATE items SET stock = stock - $1 WHERE id = $2"
+	createReservationQuery  = "INSERT INTO reservations (item_id, quantity, expires_at) VALUES ($1, $2, $3) RETURNING id"
+	markProcessedQuery      = "INSERT INTO processed_events (event_id) VALUES ($1) ON CONFLICT DO NOTHING"
+	adjustStockQuery        = "UPDATE items SET stock = GREATEST(stock + $1, 0) WHERE id = $2 AND deleted_at IS NULL"
+	expireReservationsQuery = `WITH expired AS (
+		DELETE FROM reservations WHERE expires_at <= $1 RETURNING item_id, quantity
+	), returned AS (
+		UPDATE items SET stock = items.stock + e.quantity
+		FROM (SELECT item_id, sum(quantity) AS quantity FROM expired GROUP BY item_id) e
+		WHERE items.id = e.item_id
+	)
+	SELECT count(*) FROM expired`
+
+	tagItemQuery = `WITH tag AS (
+		INSERT INTO tags (name) VALUES ($2)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	), tagged AS (
+		INSERT INTO item_tags (item_id, tag_id) SELECT $1, id FROM tag
+		WHERE EXISTS (SELECT 1 FROM items WHERE id = $1 AND deleted_at IS NULL)
+		ON CONFLICT DO NOTHING
+	)
+	SELECT EXISTS (SELECT 1 FROM items WHERE id = $1 AND deleted_at IS NULL)`
+	untagItemQuery = `DELETE FROM item_tags USING tags
+	WHERE item_tags.tag_id = tags.id AND item_tags.item_id = $1 AND tags.name = $2`
+	// taggedItemsQuery keeps the items linked to as many of the tags in $1
+	// as there are, $2, so the tags must not repeat.
+	taggedItemsQuery = `SELECT id, name, price, stock FROM items WHERE deleted_at IS NULL AND id IN (
+		SELECT item_tags.item_id FROM item_tags JOIN tags ON tags.id = item_tags.tag_id
+		WHERE tags.name = ANY($1)
+		GROUP BY item_tags.item_id
+		HAVING count(*) = $2
+	) ORDER BY id`
+)
+
+// pgForeignKeyViolation is the SQLSTATE of an insert referencing a missing row.
+const pgForeignKeyViolation = "23503"
+
+type sqlItemStore struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newSQLItemStore(db *sql.DB) *sqlItemStore {
+	return &sqlItemStore{db: db, stmts: map[string]*sql.Stmt{}}
+}
+
+// stmt returns query prepared, preparing it on first use. database/sql
+// re-prepares a statement on each connection it runs on, so every query is
+// parsed once per connection instead of once per request.
+func (s *sqlItemStore) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close releases the prepared statements. The database is left open.
+func (s *sqlItemStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range s.stmts {
+		errs = append(errs, stmt.Close())
+		delete(s.stmts, query)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *sqlItemStore) ListItems(ctx context.Context) ([]Item, error) {
+	items := []Item{}
+	err := s.EachItem(ctx, func(item Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *sqlItemStore) EachItem(ctx context.Context, fn func(Item) error) error {
+	return s.eachItem(ctx, fn, listItemsQuery)
+}
+
+func (s *sqlItemStore) EachTaggedItem(ctx context.Context, tags []string, fn func(Item) error) error {
+	return s.eachItem(ctx, fn, taggedItemsQuery, tags, len(tags))
+}
+
+func (s *sqlItemStore) eachItem(ctx context.Context, fn func(Item) error, query string, args ...any) error {
+	stmt, err := s.stmt(ctx, query)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Stock); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlItemStore) GetItem(ctx context.Context, id int) (Item, error) {
+	stmt, err := s.stmt(ctx, getItemQuery)
+	if err != nil {
+		return Item{}, err
+	}
+	var item Item
+	err = stmt.QueryRowContext(ctx, id).Scan(&item.ID, &item.Name, &item.Price, &item.Stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, errItemNotFound
+	}
+	return item, err
+}
+
+func (s *sqlItemStore) GetItems(ctx context.Context, ids []int) ([]Item, error) {
+	stmt, err := s.stmt(ctx, getItemsQuery)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Price, &item.Stock); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlItemStore) CreateItem(ctx context.Context, item Item) (Item, error) {
+	stmt, err := s.stmt(ctx, createItemQuery)
+	if err != nil {
+		return Item{}, err
+	}
+	err = stmt.QueryRowContext(ctx, item.Name, item.Price, item.Stock).Scan(&item.ID)
+	return item, err
+}
+
+func (s *sqlItemStore) UpdateItem(ctx context.Context, id int, item Item) (Item, error) {
+	stmt, err := s.stmt(ctx, updateItemQuery)
+	if err != nil {
+		return Item{}, err
+	}
+	result, err := stmt.ExecContext(ctx, item.Name, item.Price, item.Stock, id)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := checkAffected(result); err != nil {
+		return Item{}, err
+	}
+	item.ID = id
+	return item, nil
+}
+
+func (s *sqlItemStore) DeleteItem(ctx context.Context, id int) error {
+	stmt, err := s.stmt(ctx, deleteItemQuery)
+	if err != nil {
+		return err
+	}
+	result, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+func (s *sqlItemStore) TagItem(ctx context.Context, id int, tag string) error {
+	stmt, err := s.stmt(ctx, tagItemQuery)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	err = stmt.QueryRowContext(ctx, id, tag).Scan(&exists)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		return errItemNotFound
+	}
+	if err == nil && !exists {
+		return errItemNotFound
+	}
+	return err
+}
+
+func (s *sqlItemStore) UntagItem(ctx context.Context, id int, tag string) error {
+	stmt, err := s.stmt(ctx, untagItemQuery)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, id, tag)
+	return err
+}
+
+// ReserveItem locks the item's row while checking and taking its stock, so
+// concurrent reservations of the last units can't both succeed.
+func (s *sqlItemStore) ReserveItem(ctx context.Context, id int, quantity int, expiresAt time.Time) (Reservation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	err = tx.QueryRowContext(ctx, lockStockQuery, id).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reservation{}, errItemNotFound
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+	if stock < quantity {
+		return Reservation{}, errInsufficientStock
+	}
+
+	if _, err := tx.ExecContext(ctx, takeStockQuery, quantity, id); err != nil {
+		return Reservation{}, err
+	}
+	r := Reservation{ItemID: id, Quantity: quantity, ExpiresAt: expiresAt}
+	if err := tx.QueryRowContext(ctx, createReservationQuery, id, quantity, expiresAt).Scan(&r.ID); err != nil {
+		return Reservation{}, err
+	}
+	return r, tx.Commit()
+}
+
+func (s *sqlItemStore) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx, expireReservationsQuery, now).Scan(&n)
+	return n, err
+}
+
+// ApplyStockAdjustment adds adj.Delta to the item's stock, never going below
+// zero, unless an event with the same id was applied before. It reports
+// whether the adjustment was applied.
+func (s *sqlItemStore) ApplyStockAdjustment(ctx context.Context, adj stockAdjustment) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, markProcessedQuery, adj.EventID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	result, err = tx.ExecContext(ctx, adjustStockQuery, adj.Delta, adj.ItemID)
+	if err != nil {
+		return false, err
+	}
+	if err := checkAffected(result); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// CreateItems inserts items in a single round trip and returns them with
+// their ids.
+func (s *sqlItemStore) CreateItems(ctx context.Context, items []Item) ([]Item, error) {
+	created := make([]Item, len(items))
+	copy(created, items)
+
+	err := s.withConn(ctx, func(conn *pgx.Conn) error {
+		batch := &pgx.Batch{}
+		for _, item := range created {
+			batch.Queue(createItemQuery, item.Name, item.Price, item.Stock)
+		}
+		results := conn.SendBatch(ctx, batch)
+		for i := range created {
+			if err := results.QueryRow().Scan(&created[i].ID); err != nil {
+				results.Close()
+				return err
+			}
+		}
+		return results.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ImportItems loads items from CSV with a name,price header row using COPY,
+// and returns how many were created.
+func (s *sqlItemStore) ImportItems(ctx context.Context, r io.Reader) (int64, error) {
+	var n int64
+	err := s.withConn(ctx, func(conn *pgx.Conn) error {
+		tag, err := conn.PgConn().CopyFrom(ctx, r, "COPY items (name, price) FROM STDIN WITH (FORMAT csv, HEADER true)")
+		n = tag.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// withConn runs fn on a pgx connection from the pool, for the features
+// database/sql doesn't expose.
+func (s *sqlItemStore) withConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("database is not using the pgx driver")
+		}
+		return fn(c.Conn())
+	})
+}
+
+func checkAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return errItemNotFound
+	}
+	return nil
+}
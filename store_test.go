@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLItemStore(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLItemStore(requireTestDB(t))
+	ctx := context.Background()
+
+	created, err := store.CreateItem(ctx, Item{Name: "TestSQLItemStore", Price: 100})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	assert.NotZero(t, created.ID)
+
+	fetched, err := store.GetItem(ctx, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, fetched)
+
+	updated, err := store.UpdateItem(ctx, created.ID, Item{Name: "Updated", Price: 200})
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", updated.Name)
+	assert.Equal(t, created.ID, updated.ID)
+
+	assert.NoError(t, store.DeleteItem(ctx, created.ID))
+
+	_, err = store.GetItem(ctx, created.ID)
+	assert.ErrorIs(t, err, errItemNotFound)
+	assert.ErrorIs(t, store.DeleteItem(ctx, created.ID), errItemNotFound)
+	_, err = store.UpdateItem(ctx, created.ID, Item{Name: "Missing"})
+	assert.ErrorIs(t, err, errItemNotFound)
+}
+
+func TestSQLItemStoreBulk(t *testing.T) {
+	t.Parallel()
+
+	// The imports would otherwise leave rows in the shared items table.
+	db, _ := requireIsolatedDB(t)
+	store := newSQLItemStore(db)
+	ctx := context.Background()
+
+	created, err := store.CreateItems(ctx, []Item{
+		{Name: "TestSQLItemStoreBulk 1", Price: 1},
+		{Name: "TestSQLItemStoreBulk 2", Price: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create items: %v", err)
+	}
+	for _, item := range created {
+		fetched, err := store.GetItem(ctx, item.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, item, fetched)
+	}
+
+	n, err := store.ImportItems(ctx, strings.NewReader("name,price\n\"Imported, quoted\",10\nImported,20\n"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	_, err = store.ImportItems(ctx, strings.NewReader("name,price\nBroken,not a price\n"))
+	assert.Error(t, err)
+}
+
+func TestSQLItemStoreTags(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLItemStore(requireTestDB(t))
+	ctx := context.Background()
+
+	item, err := store.CreateItem(ctx, Item{Name: "TestSQLItemStoreTags", Price: 1})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(ctx, item.ID)
+	})
+
+	tag := fmt.Sprintf("test-%d", item.ID)
+	assert.NoError(t, store.TagItem(ctx, item.ID, tag))
+	// Tagging twice is a no-op.
+	assert.NoError(t, store.TagItem(ctx, item.ID, tag))
+	assert.ErrorIs(t, store.TagItem(ctx, -1, tag), errItemNotFound)
+
+	var tagged []Item
+	err = store.EachTaggedItem(ctx, []string{tag}, func(i Item) error {
+		tagged = append(tagged, i)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Item{item}, tagged)
+
+	assert.NoError(t, store.UntagItem(ctx, item.ID, tag))
+	tagged = nil
+	assert.NoError(t, store.EachTaggedItem(ctx, []string{tag}, func(i Item) error {
+		tagged = append(tagged, i)
+		return nil
+	}))
+	assert.Empty(t, tagged)
+}
+
+// BenchmarkSQLGetItem compares the store's prepared statement with parsing
+// the same query on every call.
+func BenchmarkSQLGetItem(b *testing.B) {
+	db := requireTestDB(b)
+	store := newSQLItemStore(db)
+	b.Cleanup(func() {
+		store.Close()
+	})
+	ctx := context.Background()
+
+	item, err := store.CreateItem(ctx, Item{Name: "BenchmarkSQLGetItem", Price: 100})
+	if err != nil {
+		b.Fatalf("Failed to create item: %v", err)
+	}
+	b.Cleanup(func() {
+		store.DeleteItem(ctx, item.ID)
+	})
+
+	b.Run("prepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := store.GetItem(ctx, item.ID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unprepared", func(b *testing.B) {
+		var got Item
+		for i := 0; i < b.N; i++ {
+			if err := db.QueryRowContext(ctx, getItemQuery, item.ID).Scan(&got.ID, &got.Name, &got.Price); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStatementTimeout(t *testing.T) {
+	t.Parallel()
+
+	requireTestDB(t)
+	dsn := testDB.DSN()
+	dsn.SetStatementTimeout(100 * time.Millisecond)
+	db, err := openDB(dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("SELECT pg_sleep(10)")
+	var pgErr *pgconn.PgError
+	if assert.True(t, errors.As(err, &pgErr), "got %v", err) {
+		assert.Equal(t, "57014", pgErr.Code) // query_canceled
+	}
+}
+
+func TestQueryCancellation(t *testing.T) {
+	t.Parallel()
+
+	requireTestDB(t)
+	db, err := openDB(testDB.DSN())
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = db.ExecContext(ctx, "SELECT pg_sleep(10) /* TestQueryCancellation */")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The server stopped the query rather than running it to the end.
+	assert.Eventually(t, func() bool {
+		var running int
+		err := db.QueryRow(`SELECT count(*) FROM pg_stat_activity
+			WHERE query LIKE '%/* TestQueryCancellation */' AND state = 'active' AND pid <> pg_backend_pid()`).Scan(&running)
+		return err == nil && running == 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// stressConcurrency is how many requests the stress tests fire at once.
+const stressConcurrency = 20
+
+// stress runs op n times concurrently and returns the status codes it
+// reported, indexed by call. op runs outside the test goroutine, so it must
+// not call t.Fatal (and with it the asserting apiClient helpers): it returns
+// its errors instead, and stress fails the test with them once all calls are
+// done.
+func stress(t *testing.T, n int, op func(i int) (int, error)) []int {
+	t.Helper()
+	trackTest(t)
+
+	statuses := make([]int, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			statuses[i], errs[i] = op(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("call %d: %v", i, err)
+		}
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return statuses
+}
+
+func countStatus(statuses []int, status int) int {
+	n := 0
+	for _, s := range statuses {
+		if s == status {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConcurrentCreatesGetDistinctIDs(t *testing.T) {
+	t.Parallel()
+
+	ids := make([]int, stressConcurrency)
+	statuses := stress(t, stressConcurrency, func(i int) (int, error) {
+		status, body, err := client.Send(http.MethodPost, "/items", Item{Name: fmt.Sprintf("TestConcurrentCreates-%d", i), Price: i})
+		if err != nil || status != http.StatusCreated {
+			return status, err
+		}
+		var item Item
+		if err := json.Unmarshal(body, &item); err != nil {
+			return status, fmt.Errorf("decode %q: %w", body, err)
+		}
+		ids[i] = item.ID
+		return status, nil
+	})
+	t.Cleanup(func() {
+		for _, id := range ids {
+			client.Do(t, http.MethodDelete, fmt.Sprintf("/items/%d", id), nil)
+		}
+	})
+
+	assert.Equal(t, stressConcurrency, countStatus(statuses, http.StatusCreated))
+	seen := map[int]bool{}
+	for _, id := range ids {
+		assert.False(t, seen[id], "id %d handed out twice", id)
+		seen[id] = true
+	}
+}
+
+func TestConcurrentUpdatesAreNotTorn(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t)
+	path := fmt.Sprintf("/items/%d", item.ID)
+	statuses := stress(t, stressConcurrency, func(i int) (int, error) {
+		status, _, err := client.Send(http.MethodPut, path, Item{Name: fmt.Sprintf("update-%d", i), Price: i})
+		return status, err
+	})
+
+	assert.Equal(t, stressConcurrency, countStatus(statuses, http.StatusOK))
+
+	// The last write wins, but name and price must come from the same write.
+	final := client.GetItem(t, item.ID)
+	assert.Equal(t, fmt.Sprintf("update-%d", final.Price), final.Name)
+}
+
+func TestConcurrentDeletesSucceedOnce(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t)
+	path := fmt.Sprintf("/items/%d", item.ID)
+	statuses := stress(t, stressConcurrency, func(i int) (int, error) {
+		status, _, err := client.Send(http.MethodDelete, path, nil)
+		return status, err
+	})
+
+	assert.Equal(t, 1, countStatus(statuses, http.StatusNoContent))
+	assert.Equal(t, stressConcurrency-1, countStatus(statuses, http.StatusNotFound))
+}
+
+// TestConcurrentReservationsKeepStock races reservations against readers of
+// the same item: every successful reservation must take exactly its unit, so
+// none is lost to a concurrent one, and no reader may see the stock below 0.
+func TestConcurrentReservationsKeepStock(t *testing.T) {
+	t.Parallel()
+
+	const initial = stressConcurrency / 4
+	item := factory.Item(t, withStock(initial))
+	itemPath := fmt.Sprintf("/items/%d", item.ID)
+	reservePath := itemPath + "/reservations"
+
+	// Even calls reserve a unit, odd calls read the stock.
+	seen := make([]int, stressConcurrency)
+	statuses := stress(t, stressConcurrency, func(i int) (int, error) {
+		if i%2 == 0 {
+			status, _, err := client.Send(http.MethodPost, reservePath, reservationRequest{Quantity: 1})
+			return status, err
+		}
+		status, body, err := client.Send(http.MethodGet, itemPath, nil)
+		if err != nil || status != http.StatusOK {
+			return status, err
+		}
+		var got Item
+		if err := json.Unmarshal(body, &got); err != nil {
+			return status, fmt.Errorf("decode %q: %w", body, err)
+		}
+		seen[i] = got.Stock
+		return status, nil
+	})
+
+	reserved := countStatus(statuses, http.StatusCreated)
+	assert.Equal(t, initial, reserved, "reservations should take all the stock and no more")
+	assert.Equal(t, stressConcurrency/2-reserved, countStatus(statuses, http.StatusConflict))
+	assert.Equal(t, stressConcurrency/2, countStatus(statuses, http.StatusOK))
+	for i, stock := range seen {
+		assert.GreaterOrEqual(t, stock, 0, "call %d saw negative stock", i)
+	}
+	assert.Equal(t, initial-reserved, client.GetItem(t, item.ID).Stock)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"regexp"
+)
+
+// tagPattern is what a tag may look like: short, lowercase and safe to use
+// in a path or query without escaping.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// itemTag parses the :tag path parameter, responding with 400 when it is not
+// a valid tag.
+func itemTag(c *gin.Context) (string, bool) {
+	tag := c.Param("tag")
+	if !tagPattern.MatchString(tag) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag"})
+		return "", false
+	}
+	return tag, true
+}
+
+// tagFilter returns the distinct tags of ?tag=sale&tag=organic, responding
+// with 400 when one is not a valid tag.
+func tagFilter(c *gin.Context) ([]string, bool) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range c.QueryArray("tag") {
+		if !tagPattern.MatchString(tag) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag"})
+			return nil, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
+
+func (g *GoPOS) tagItem(c *gin.Context) {
+	id, ok := itemID(c)
+	if !ok {
+		return
+	}
+	tag, ok := itemTag(c)
+	if !ok {
+		return
+	}
+	if err := g.store.TagItem(c.Request.Context(), id, tag); err != nil {
+		storeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (g *GoPOS) untagItem(c *gin.Context) {
+	id, ok := itemID(c)
+	if !ok {
+		return
+	}
+	tag, ok := itemTag(c)
+	if !ok {
+		return
+	}
+	if err := g.store.UntagItem(c.Request.Context(), id, tag); err != nil {
+		storeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestItemTags(t *testing.T) {
+	t.Parallel()
+
+	// Tags unique to this run, so items of other tests never match.
+	sale := fmt.Sprintf("sale-%d", dataGenFor(t).rng.Int63())
+	organic := fmt.Sprintf("organic-%d", dataGenFor(t).rng.Int63())
+	both := factory.Item(t)
+	onlySale := factory.Item(t)
+	factory.Item(t)
+
+	for _, tag := range []struct {
+		id  int
+		tag string
+	}{{both.ID, sale}, {both.ID, organic}, {onlySale.ID, sale}, {onlySale.ID, organic}} {
+		client.Request(t, http.MethodPut, fmt.Sprintf("/items/%d/tags/%s", tag.id, tag.tag), nil, http.StatusNoContent, nil)
+	}
+	client.Request(t, http.MethodDelete, fmt.Sprintf("/items/%d/tags/%s", onlySale.ID, organic), nil, http.StatusNoContent, nil)
+
+	var items []Item
+	client.Request(t, http.MethodGet, "/items?tag="+sale, nil, http.StatusOK, &items)
+	assert.Equal(t, []Item{both, onlySale}, items)
+
+	client.Request(t, http.MethodGet, fmt.Sprintf("/items?tag=%s&tag=%s&tag=%s", sale, organic, sale), nil, http.StatusOK, &items)
+	assert.Equal(t, []Item{both}, items)
+}
+
+func TestItemTagsInvalid(t *testing.T) {
+	t.Parallel()
+
+	item := factory.Item(t)
+	client.Request(t, http.MethodPut, fmt.Sprintf("/items/%d/tags/Not%%20Valid", item.ID), nil, http.StatusBadRequest, nil)
+	client.Request(t, http.MethodPut, "/items/0/tags/sale", nil, http.StatusNotFound, nil)
+	client.Request(t, http.MethodGet, "/items?tag=", nil, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// tenantPattern is what a tenant name may look like. The name becomes part
+// of a database name, so it is kept to safe identifier characters.
+var tenantPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,29}$`)
+
+var errTenantExists = errors.New("tenant already exists")
+
+// Tenant is a customer served from a database of its own. The tenants table
+// of the main database maps each to its database.
+type Tenant struct {
+	Name      string    `json:"name"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// provisionTenant creates the database of a new tenant on the server of
+// dsn, migrates it with the migrations in migrationsDir and registers it in
+// the tenants table of db. The database is dropped again if any step fails.
+func provisionTenant(ctx context.Context, db *sql.DB, dsn DSN, name, migrationsDir string) (Tenant, error) {
+	if !tenantPattern.MatchString(name) {
+		return Tenant{}, fmt.Errorf("invalid tenant name %q", name)
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM tenants WHERE name = $1)", name).Scan(&exists); err != nil {
+		return Tenant{}, err
+	}
+	if exists {
+		return Tenant{}, errTenantExists
+	}
+
+	tenant := Tenant{Name: name, Database: "gopos_tenant_" + name}
+	if _, err := db.ExecContext(ctx, "CREATE DATABASE "+tenant.Database); err != nil {
+		return Tenant{}, err
+	}
+	err := migrateTenant(dsn, tenant.Database, migrationsDir)
+	if err == nil {
+		err = db.QueryRowContext(ctx, "INSERT INTO tenants (name, database) VALUES ($1, $2) RETURNING created_at",
+			tenant.Name, tenant.Database).Scan(&tenant.CreatedAt)
+	}
+	if err != nil {
+		db.Exec("DROP DATABASE IF EXISTS " + tenant.Database + " WITH (FORCE)")
+		return Tenant{}, err
+	}
+	return tenant, nil
+}
+
+func migrateTenant(dsn DSN, database, migrationsDir string) error {
+	dsn.DBName = database
+	tenantDB, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer tenantDB.Close()
+	return migrateUp(tenantDB, migrationsDir)
+}
+
+func listTenants(ctx context.Context, db *sql.DB) ([]Tenant, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, database, created_at FROM tenants ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []Tenant{}
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.Name, &t.Database, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+type tenantRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (g *GoPOS) createTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !tenantPattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tenant name"})
+		return
+	}
+	if g.db == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Tenants need a database"})
+		return
+	}
+	dsn, err := dbDSN()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	viper.SetDefault("GOPOS_MIGRATIONS_DIR", "./db/migrations")
+	tenant, err := provisionTenant(c.Request.Context(), g.db, dsn, req.Name, viper.GetString("GOPOS_MIGRATIONS_DIR"))
+	if errors.Is(err, errTenantExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tenant already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, tenant)
+}
+
+func (g *GoPOS) getTenants(c *gin.Context) {
+	if g.db == nil {
+		c.JSON(http.StatusOK, []Tenant{})
+		return
+	}
+	tenants, err := listTenants(c.Request.Context(), g.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tenants)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProvisionTenant(t *testing.T) {
+	t.Parallel()
+
+	db := requireTestDB(t)
+	ctx := context.Background()
+	name := fmt.Sprintf("t%d", dataGenFor(t).rng.Int63())
+
+	tenant, err := provisionTenant(ctx, db, testDB.DSN(), name, "./db/migrations")
+	if err != nil {
+		t.Fatalf("Failed to provision tenant: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM tenants WHERE name = $1", name)
+		db.Exec("DROP DATABASE IF EXISTS " + tenant.Database + " WITH (FORCE)")
+	})
+	assert.Equal(t, "gopos_tenant_"+name, tenant.Database)
+
+	dsn := testDB.DSN()
+	dsn.DBName = tenant.Database
+	tenantDB, err := sql.Open(dbDriver, dsn.String())
+	if err != nil {
+		t.Fatalf("Failed to connect to tenant database: %v", err)
+	}
+	defer tenantDB.Close()
+	assert.NoError(t, checkSchema(tenantDB, schemaVersion))
+
+	tenants, err := listTenants(ctx, db)
+	assert.NoError(t, err)
+	assert.Contains(t, tenants, tenant)
+
+	_, err = provisionTenant(ctx, db, testDB.DSN(), name, "./db/migrations")
+	assert.ErrorIs(t, err, errTenantExists)
+	_, err = provisionTenant(ctx, db, testDB.DSN(), "Robert'); DROP TABLE items;--", "./db/migrations")
+	assert.Error(t, err)
+}
+
+func TestTenantDatabases(t *testing.T) {
+	requirePostgres(t)
+	mainDB := requireTestDB(t)
+
+	var dbs []*sql.DB
+	for _, name := range []string{"acme", "globex"} {
+		name = fmt.Sprintf("%s_%d", name, dataGenFor(t).rng.Intn(1e6))
+		dsn, err := localTestContainer.CreateTenantDatabase(name)
+		if err != nil {
+			t.Fatalf("Failed to create tenant database: %v", err)
+		}
+		db, err := sql.Open(dbDriver, dsn.String())
+		if err != nil {
+			t.Fatalf("Failed to connect to tenant database: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+			mainDB.Exec("DELETE FROM tenants WHERE name = $1", name)
+			mainDB.Exec("DROP DATABASE IF EXISTS " + dsn.DBName + " WITH (FORCE)")
+		})
+		dbs = append(dbs, db)
+	}
+
+	_, err := newSQLItemStore(dbs[0]).CreateItem(context.Background(), Item{Name: "TestTenantDatabases", Price: 1})
+	assert.NoError(t, err)
+
+	// The tenants share the Postgres container but not their data.
+	items, err := newSQLItemStore(dbs[1]).ListItems(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
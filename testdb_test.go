@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errNoTestDatabase = errors.New("no test database available")
+
+var (
+	testDBOnce sync.Once
+	testDB     *TestDatabase
+	testDBErr  error
+)
+
+// requireTestDB connects to a migrated database for tests that only need the
+// data layer. TEST_DB_BACKEND=embedded runs Postgres through
+// embedded-postgres instead of Docker; otherwise the harness database is used
+// and the test is skipped when there is none.
+func requireTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	trackTest(t)
+
+	testDBOnce.Do(func() {
+		if os.Getenv("TEST_DB_BACKEND") == "embedded" {
+			testDB, testDBErr = StartEmbeddedDatabase("./db/migrations")
+		} else {
+			testDB, testDBErr = harnessDatabase()
+		}
+	})
+	if errors.Is(testDBErr, errNoTestDatabase) {
+		t.Skip("set TEST_DB_BACKEND=embedded to run database tests without Docker")
+	}
+	if testDBErr != nil {
+		t.Fatalf("Failed to start test database: %v", testDBErr)
+	}
+
+	db, err := testDB.Open()
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// closeTestDB stops the database started by requireTestDB, if any.
+func closeTestDB() {
+	if testDB != nil {
+		testDB.Close()
+	}
+}
+
+// requireFreshDB creates an empty database next to the test database and
+// drops it when the test finishes.
+func requireFreshDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, _ := createTestDatabase(t)
+	return db
+}
+
+// requireIsolatedDB creates a database of its own for the test, named after
+// it, and migrates it, so the test can't see or disturb the rows of other
+// tests. It returns the connection and its connection string, e.g. for
+// starting a store or a second client on the same database. The database
+// is dropped when the test finishes.
+func requireIsolatedDB(t testing.TB) (*sql.DB, DSN) {
+	t.Helper()
+	db, dsn := createTestDatabase(t)
+	if err := migrateUp(db, "./db/migrations"); err != nil {
+		t.Fatalf("Failed to migrate database %s: %v", dsn.DBName, err)
+	}
+	return db, dsn
+}
+
+// createTestDatabase creates an empty database named after the test next to
+// the test database and drops it when the test finishes.
+func createTestDatabase(t testing.TB) (*sql.DB, DSN) {
+	t.Helper()
+	admin := requireTestDB(t)
+
+	name := testDatabaseName(t.Name(), rand.Int63())
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	dsn := testDB.DSN()
+	dsn.DBName = name
+	db, err := sql.Open(dbDriver, dsn.String())
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec("DROP DATABASE " + name + " WITH (FORCE)"); err != nil {
+			t.Errorf("Failed to drop database %s: %v", name, err)
+		}
+	})
+	return db, dsn
+}
+
+// testDatabaseName turns a test name into a database name, test_<name>_<n>,
+// short enough for Postgres's 63 byte limit. n keeps repeated and parallel
+// runs of the same test apart.
+func testDatabaseName(test string, n int64) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(test))
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("test_%s_%x", name, uint32(n))
+}
+
+// RunInRollbackTx runs fn in a transaction on the test database that is
+// rolled back when the test finishes, so a data layer test leaves nothing
+// behind and parallel tests don't see its rows.
+func RunInRollbackTx(t testing.TB, fn func(tx *sql.Tx)) {
+	t.Helper()
+	db := requireTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("Failed to roll back: %v", err)
+		}
+	})
+	fn(tx)
+}
+
+func TestTestDatabaseName(t *testing.T) {
+	assert.Equal(t, "test_testitems_create_item_ff", testDatabaseName("TestItems/create item", 255))
+	name := testDatabaseName(strings.Repeat("TestVeryLongName", 10), rand.Int63())
+	assert.LessOrEqual(t, len(name), 63)
+}
+
+func TestIsolatedDB(t *testing.T) {
+	t.Parallel()
+
+	db, dsn := requireIsolatedDB(t)
+	assert.Contains(t, dsn.DBName, "test_testisolateddb_")
+	store := newSQLItemStore(db)
+	_, err := store.CreateItem(context.Background(), Item{Name: "TestIsolatedDB", Price: 1})
+	assert.NoError(t, err)
+
+	other, _ := requireIsolatedDB(t)
+	var n int
+	assert.NoError(t, other.QueryRow("SELECT count(*) FROM items").Scan(&n))
+	assert.Zero(t, n)
+}
+
+func TestRollbackTx(t *testing.T) {
+	t.Parallel()
+
+	var id int
+	t.Run("insert", func(t *testing.T) {
+		RunInRollbackTx(t, func(tx *sql.Tx) {
+			err := tx.QueryRow("INSERT INTO items (name, price) VALUES ('TestRollbackTx', 1) RETURNING id").Scan(&id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			assert.NoError(t, tx.QueryRow("SELECT count(*) FROM items WHERE id = $1", id).Scan(&n))
+			assert.Equal(t, 1, n)
+		})
+	})
+	if id == 0 {
+		return
+	}
+
+	var n int
+	assert.NoError(t, requireTestDB(t).QueryRow("SELECT count(*) FROM items WHERE id = $1", id).Scan(&n))
+	assert.Zero(t, n)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+func newTestenvCmd() *cobra.Command {
+	testenvCmd := &cobra.Command{
+		Use:   "testenv",
+		Short: "Test environment maintenance commands.",
+	}
+
+	cleanupCmd := &cobra.Command{
+		Use:          "cleanup",
+		Short:        "Remove the containers, networks and images test environments left behind.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         testenvCleanup,
+	}
+	cleanupCmd.Flags().String("run", "", "only remove those of this run ID")
+	cleanupCmd.Flags().Bool("expired", false, "only remove expired containers and networks")
+	cleanupCmd.Flags().Bool("images", true, "also remove the app images")
+
+	pullCmd := &cobra.Command{
+		Use:          "pull",
+		Short:        "Pull the images the test environment runs, e.g. to warm a CI cache.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         testenvPull,
+	}
+	pullCmd.Flags().Duration("timeout", defaultPhaseTimeouts[PhasePull], "how long to wait before giving up")
+
+	testenvCmd.AddCommand(cleanupCmd)
+	testenvCmd.AddCommand(pullCmd)
+	return testenvCmd
+}
+
+func testenvCleanup(cmd *cobra.Command, args []string) error {
+	runID, _ := cmd.Flags().GetString("run")
+	onlyExpired, _ := cmd.Flags().GetBool("expired")
+	images, _ := cmd.Flags().GetBool("images")
+
+	pool, err := dockertest.NewPool(dockerEndpoint())
+	if err != nil {
+		return fmt.Errorf("could not construct pool: %w", err)
+	}
+	now := time.Now()
+	return reap(pool, images && !onlyExpired, func(labels map[string]string) bool {
+		if runID != "" && labels[runLabel] != runID {
+			return false
+		}
+		return !onlyExpired || expired(labels, now)
+	})
+}
+
+func testenvPull(cmd *cobra.Command, args []string) error {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	pool, err := dockertest.NewPool(dockerEndpoint())
+	if err != nil {
+		return fmt.Errorf("could not construct pool: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+	o := defaultOptions()
+	return pullImages(ctx, pool, o.images(), o.auths())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// artifactsDir is where the container logs, inspect output and database dump
+// of failed integration tests are written.
+const artifactsDir = "test-artifacts"
+
+// trackedTests holds the tests trackTest already registered a cleanup for.
+var trackedTests sync.Map
+
+// localTestContainer is the container environment started by the
+// integration TestMain.
+var localTestContainer *LocalTestContainer
+
+// integrationEnv is set by TestMain once the container environment is up.
+var integrationEnv bool
+
+// requireIntegration skips tests that need the container environment when it
+// is not running, i.e. without -tags integration or with -short.
+func requireIntegration(t testing.TB) {
+	t.Helper()
+	if !integrationEnv {
+		t.Skip("requires the container environment: run with -tags integration and without -short")
+	}
+	trackTest(t)
+}
+
+// requirePostgres is requireIntegration for tests of what only Postgres
+// supports, skipping them with TEST_DB_ENGINE=mysql.
+func requirePostgres(t testing.TB) {
+	t.Helper()
+	requireIntegration(t)
+	if localTestContainer.dbHostMySQL != nil {
+		t.Skip("requires Postgres, the environment runs MySQL")
+	}
+}
+
+// trackTest captures the environment's artifacts into
+// test-artifacts/<test name>/ when t fails. It is called by every helper that
+// touches the environment, so tests don't need to register it themselves.
+func trackTest(t testing.TB) {
+	if !integrationEnv {
+		return
+	}
+	if _, loaded := trackedTests.LoadOrStore(t, true); loaded {
+		return
+	}
+	t.Cleanup(func() {
+		trackedTests.Delete(t)
+		if !t.Failed() {
+			return
+		}
+		dir := filepath.Join(artifactsDir, strings.ReplaceAll(t.Name(), "/", "_"))
+		if err := localTestContainer.CaptureArtifacts(dir); err != nil {
+			t.Logf("Failed to capture some artifacts: %v", err)
+		}
+		t.Logf("Artifacts captured in %s", dir)
+	})
+}
+
+// runUnit runs the tests against the API served from the in-memory store.
+func runUnit(m *testing.M) int {
+	srv := httptest.NewServer(newMemRouter())
+	client = newAPIClient(srv.URL)
+
+	result := m.Run()
+
+	srv.Close()
+	closeTestDB()
+	writeFlakyReport()
+	return result
+}
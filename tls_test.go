@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPostgresTLS(t *testing.T) {
+	requireIntegration(t)
+	if localTestContainer.certsDir == "" {
+		t.Skip("run with TEST_POSTGRES_TLS=1")
+	}
+	db, err := localTestContainer.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Every connection over TCP, the app's included, uses TLS.
+	client.GetItems(t)
+	var clients, plain int
+	err = db.QueryRow(`SELECT count(*), count(*) FILTER (WHERE NOT s.ssl)
+		FROM pg_stat_activity a JOIN pg_stat_ssl s USING (pid)
+		WHERE a.backend_type = 'client backend' AND a.client_addr IS NOT NULL`).Scan(&clients, &plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Greater(t, clients, 1)
+	assert.Zero(t, plain)
+
+	dsn := localTestContainer.dbHostDSN
+	dsn.SSLMode = "disable"
+	plainDB, err := sql.Open(dbDriver, dsn.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plainDB.Close()
+	assert.Error(t, plainDB.Ping(), "Postgres accepted a connection without TLS")
+}
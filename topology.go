@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Topology describes the sidecar services of the test environment, read
+// from a testenv.yaml:
+//
+//	services:
+//	  redis:
+//	    image: redis:7-alpine
+//	    ports: ["6379"]
+//	    wait:
+//	      tcp: "6379"
+//	app:
+//	  env:
+//	    GOPOS_REDIS_ADDR: redis:6379
+//
+// The services start once the database is up and before the app,
+// each reachable on the test network under its name.
+type Topology struct {
+	Services map[string]ServiceSpec `yaml:"services"`
+	App      struct {
+		// Env is added to the app container's environment, e.g. to point
+		// it at the services.
+		Env map[string]string `yaml:"env"`
+	} `yaml:"app"`
+
+	// order is the start order of the services, dependencies first.
+	order []string
+}
+
+// ServiceSpec is one service of a Topology.
+type ServiceSpec struct {
+	// Image is the image to run, as repository[:tag].
+	Image      string            `yaml:"image"`
+	Env        map[string]string `yaml:"env"`
+	Entrypoint []string          `yaml:"entrypoint"`
+	Command    []string          `yaml:"command"`
+	// Mounts are bind mounts as host:container[:ro], with host paths
+	// relative to the topology file.
+	Mounts []string `yaml:"mounts"`
+	// Ports are the container ports to publish, e.g. "6379" or "53/udp",
+	// on a random host port unless given as "16379:6379".
+	Ports []string `yaml:"ports"`
+	// DependsOn names the services that must be up first. "db" is always
+	// up before the services.
+	DependsOn []string `yaml:"depends_on"`
+	Wait      WaitSpec `yaml:"wait"`
+
+	// waits are the strategies of the helpers starting a service, added to
+	// Wait.
+	waits []WaitStrategy
+}
+
+// WaitSpec tells when a service is up. Without any, it is up once started.
+type WaitSpec struct {
+	// Log is a regular expression the service's logs must match.
+	Log string `yaml:"log"`
+	// TCP is a published port that must accept connections.
+	TCP string `yaml:"tcp"`
+	// HTTP is a request that must answer with a 2xx status.
+	HTTP *HTTPWait `yaml:"http"`
+}
+
+// HTTPWait is a GET of path on a published port.
+type HTTPWait struct {
+	Port string `yaml:"port"`
+	Path string `yaml:"path"`
+}
+
+func (w WaitSpec) strategies() []WaitStrategy {
+	var strategies []WaitStrategy
+	if w.Log != "" {
+		strategies = append(strategies, WaitForLogLine(w.Log))
+	}
+	if w.TCP != "" {
+		strategies = append(strategies, WaitForPort(w.TCP))
+	}
+	if w.HTTP != nil {
+		strategies = append(strategies, WaitForHTTP(w.HTTP.Port, w.HTTP.Path))
+	}
+	return strategies
+}
+
+var serviceName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// LoadTopology reads and validates a topology file.
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var t Topology
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for name, s := range t.Services {
+		if !serviceName.MatchString(name) || name == "db" || name == "app" || name == "migrate" || name == "build" {
+			return nil, fmt.Errorf("%s: invalid service name %q", path, name)
+		}
+		if s.Image == "" {
+			return nil, fmt.Errorf("%s: service %s has no image", path, name)
+		}
+		if s.Wait.Log != "" {
+			if _, err := regexp.Compile(s.Wait.Log); err != nil {
+				return nil, fmt.Errorf("%s: service %s: %w", path, name, err)
+			}
+		}
+		for i, mount := range s.Mounts {
+			source, target, ok := strings.Cut(mount, ":")
+			if !ok {
+				return nil, fmt.Errorf("%s: service %s: mount %q has no container path", path, name, mount)
+			}
+			if !filepath.IsAbs(source) {
+				if source, err = filepath.Abs(filepath.Join(dir, source)); err != nil {
+					return nil, err
+				}
+			}
+			s.Mounts[i] = source + ":" + target
+		}
+		t.Services[name] = s
+	}
+	if t.order, err = startOrder(t.Services); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// startOrder sorts the services so each comes after its dependencies.
+func startOrder(services map[string]ServiceSpec) ([]string, error) {
+	deps := map[string][]string{}
+	for name, s := range services {
+		deps[name] = serviceDeps(s)
+	}
+	return dependencyOrder(deps)
+}
+
+// serviceDeps returns the services s depends on besides "db".
+func serviceDeps(s ServiceSpec) []string {
+	var deps []string
+	for _, dep := range s.DependsOn {
+		if dep != "db" {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// WithTopology starts the services of the topology file at path with the
+// environment, see Topology.
+func WithTopology(path string) Option {
+	return func(o *options) {
+		o.topologyFile = path
+	}
+}
+
+// splitImage splits "repository[:tag]", where the repository may have a
+// registry with a port.
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+// startService runs a service of the topology on network and waits until it
+// is up, as its wait strategies tell unless WithWaitStrategy replaced them.
+func startService(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string, name string, s ServiceSpec) (*dockertest.Resource, error) {
+	resource, err := runService(pool, network, o, name, s)
+	if err != nil {
+		return nil, err
+	}
+	target := WaitTarget{Pool: pool, Resource: resource, Host: host}
+	if err := waitFor(ctx, target, o.container(name).wait, append(s.waits, s.Wait.strategies()...)...); err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("%s didn't come up: %w", name, err)
+	}
+	return resource, nil
+}
+
+// runService runs a service on network without waiting for it.
+func runService(pool *dockertest.Pool, network *docker.Network, o *options, name string, s ServiceSpec) (*dockertest.Resource, error) {
+	repository, tag := splitImage(s.Image)
+	var env []string
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	var ports []string
+	bindings := map[docker.Port][]docker.PortBinding{}
+	for _, port := range s.Ports {
+		hostPort, port, ok := strings.Cut(port, ":")
+		if !ok {
+			hostPort, port = "", hostPort
+		}
+		ports = append(ports, portSpec(port))
+		if hostPort != "" {
+			bindings[docker.Port(portSpec(port))] = []docker.PortBinding{{HostIP: "0.0.0.0", HostPort: hostPort}}
+		}
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Name:         name + "-" + o.runID,
+		Repository:   repository,
+		Tag:          tag,
+		Env:          env,
+		Entrypoint:   s.Entrypoint,
+		Cmd:          s.Command,
+		Mounts:       s.Mounts,
+		ExposedPorts: ports,
+		PortBindings: bindings,
+		Labels:       o.labels(),
+	}, func(config *docker.HostConfig) {
+		o.hostConfig(config)
+		o.container(name).apply(config)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not start %s: %w", name, err)
+	}
+	o.logs.follow(pool, name, resource)
+	if err := connectNetwork(pool, resource, network, o.containerAliases(name), o.staticIPs[name]); err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("could not connect %s: %w", name, err)
+	}
+	return resource, nil
+}
+
+// portSpec adds the protocol to a port without one.
+func portSpec(port string) string {
+	if strings.Contains(port, "/") {
+		return port
+	}
+	return port + "/tcp"
+}
+
+// ServiceAddr returns the host:port the port of a topology service is
+// published at.
+func (l LocalTestContainer) ServiceAddr(name string, port string) (string, error) {
+	resource, ok := l.services[name]
+	if !ok {
+		return "", fmt.Errorf("no service %s", name)
+	}
+	published := resource.GetPort(portSpec(port))
+	if published == "" {
+		return "", fmt.Errorf("service %s doesn't publish %s", name, port)
+	}
+	return net.JoinHostPort(l.Host, published), nil
+}
+
+func (l LocalTestContainer) hasService(name string) bool {
+	_, ok := l.services[name]
+	return ok
+}
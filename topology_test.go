@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTopology(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "testenv.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTopology(t *testing.T) {
+	path := writeTopology(t, `
+services:
+  worker:
+    image: registry.local:5000/gopos/worker
+    depends_on: [kafka, db]
+  kafka:
+    image: bitnami/kafka:3.7
+    depends_on: [zookeeper]
+    ports: ["9092"]
+    wait:
+      log: "started \\(kafka.server"
+  zookeeper:
+    image: zookeeper:3.9
+    mounts: ["./zoo.cfg:/conf/zoo.cfg:ro"]
+    wait:
+      tcp: "2181"
+app:
+  env:
+    GOPOS_KAFKA_BROKERS: kafka:9092
+`)
+	topology, err := LoadTopology(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"zookeeper", "kafka", "worker"}, topology.order)
+	assert.Equal(t, []string{filepath.Join(filepath.Dir(path), "zoo.cfg") + ":/conf/zoo.cfg:ro"}, topology.Services["zookeeper"].Mounts)
+
+	o := defaultOptions()
+	o.topology = topology
+	assert.Equal(t, []string{"GOPOS_KAFKA_BROKERS=kafka:9092"}, o.appEnv())
+
+	repository, tag := splitImage(topology.Services["worker"].Image)
+	assert.Equal(t, "registry.local:5000/gopos/worker", repository)
+	assert.Equal(t, "latest", tag)
+	repository, tag = splitImage(topology.Services["kafka"].Image)
+	assert.Equal(t, "bitnami/kafka", repository)
+	assert.Equal(t, "3.7", tag)
+}
+
+func TestLoadTopologyErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"no image":        "services:\n  redis: {}\n",
+		"reserved name":   "services:\n  db:\n    image: postgres\n",
+		"unknown field":   "services:\n  redis:\n    image: redis\n    healthcheck: {}\n",
+		"unknown service": "services:\n  redis:\n    image: redis\n    depends_on: [cache]\n",
+		"cycle":           "services:\n  a:\n    image: a\n    depends_on: [b]\n  b:\n    image: b\n    depends_on: [a]\n",
+		"bad log pattern": "services:\n  redis:\n    image: redis\n    wait:\n      log: \"(\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadTopology(writeTopology(t, content))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const toxiproxyImage = "ghcr.io/shopify/toxiproxy:2.9.0"
+
+// toxiproxyDBPort is where the proxy to Postgres listens on the test
+// network.
+const toxiproxyDBPort = "15432"
+
+// WithToxiproxy puts a Toxiproxy between the app and Postgres, so tests
+// can degrade the app's database connection with DBLatency, DBBandwidth
+// and DBResetPeer. The migrations and the tests' own connections go to
+// Postgres directly.
+func WithToxiproxy() Option {
+	return func(o *options) {
+		o.toxiproxy = true
+		o.addSidecar(sidecar{
+			name:  "toxiproxy",
+			image: toxiproxyImage,
+			start: createToxiproxy,
+		})
+	}
+}
+
+// createToxiproxy starts Toxiproxy and creates the proxy to Postgres.
+func createToxiproxy(ctx context.Context, pool *dockertest.Pool, network *docker.Network, o *options, host string) (*dockertest.Resource, error) {
+	resource, err := startService(ctx, pool, network, o, host, "toxiproxy", ServiceSpec{
+		Image: toxiproxyImage,
+		Ports: []string{"8474"},
+		Wait:  WaitSpec{HTTP: &HTTPWait{Port: "8474", Path: "/version"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	api := toxiproxyAPI{url: "http://" + net.JoinHostPort(host, resource.GetPort("8474/tcp"))}
+	err = api.do(ctx, http.MethodPost, "/proxies", map[string]any{
+		"name":     "postgres",
+		"listen":   "0.0.0.0:" + toxiproxyDBPort,
+		"upstream": net.JoinHostPort(o.aliases["db"][0], "5432"),
+		"enabled":  true,
+	})
+	if err != nil {
+		resource.Close()
+		return nil, fmt.Errorf("could not create the postgres proxy: %w", err)
+	}
+	return resource, nil
+}
+
+// toxiproxyAPI is a client of the Toxiproxy HTTP API.
+type toxiproxyAPI struct {
+	url string
+}
+
+func (a toxiproxyAPI) do(ctx context.Context, method string, path string, body any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Toxic degrades a Toxiproxy connection, see
+// https://github.com/Shopify/toxiproxy#toxics for the types and their
+// attributes.
+type Toxic struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Stream is "downstream", towards the app, or "upstream", towards
+	// Postgres.
+	Stream     string         `json:"stream"`
+	Toxicity   float64        `json:"toxicity"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+func (l LocalTestContainer) toxiproxy() (toxiproxyAPI, error) {
+	addr, err := l.ServiceAddr("toxiproxy", "8474")
+	if err != nil {
+		return toxiproxyAPI{}, fmt.Errorf("%w, see WithToxiproxy", err)
+	}
+	return toxiproxyAPI{url: "http://" + addr}, nil
+}
+
+// AddDBToxic adds a toxic to the app's connection to Postgres. Toxicity
+// defaults to 1, affecting every connection.
+func (l LocalTestContainer) AddDBToxic(toxic Toxic) error {
+	api, err := l.toxiproxy()
+	if err != nil {
+		return err
+	}
+	if toxic.Toxicity == 0 {
+		toxic.Toxicity = 1
+	}
+	if toxic.Stream == "" {
+		toxic.Stream = "downstream"
+	}
+	return api.do(context.Background(), http.MethodPost, "/proxies/postgres/toxics", toxic)
+}
+
+// RemoveDBToxic removes the toxic named name.
+func (l LocalTestContainer) RemoveDBToxic(name string) error {
+	api, err := l.toxiproxy()
+	if err != nil {
+		return err
+	}
+	return api.do(context.Background(), http.MethodDelete, "/proxies/postgres/toxics/"+name, nil)
+}
+
+// ResetDBToxics removes every toxic.
+func (l LocalTestContainer) ResetDBToxics() error {
+	api, err := l.toxiproxy()
+	if err != nil {
+		return err
+	}
+	return api.do(context.Background(), http.MethodPost, "/reset", nil)
+}
+
+// DBLatency delays every response of Postgres to the app by latency, give
+// or take jitter.
+func (l LocalTestContainer) DBLatency(latency time.Duration, jitter time.Duration) error {
+	return l.AddDBToxic(Toxic{Name: "latency", Type: "latency", Attributes: map[string]any{
+		"latency": latency.Milliseconds(),
+		"jitter":  jitter.Milliseconds(),
+	}})
+}
+
+// DBBandwidth limits the data Postgres sends the app to rate KB/s.
+func (l LocalTestContainer) DBBandwidth(rate int) error {
+	return l.AddDBToxic(Toxic{Name: "bandwidth", Type: "bandwidth", Attributes: map[string]any{"rate": rate}})
+}
+
+// DBResetPeer resets the app's connections to Postgres after timeout, or
+// at once if it is 0.
+func (l LocalTestContainer) DBResetPeer(timeout time.Duration) error {
+	return l.AddDBToxic(Toxic{Name: "reset_peer", Type: "reset_peer", Attributes: map[string]any{"timeout": timeout.Milliseconds()}})
+}
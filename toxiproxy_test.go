@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// requireToxiproxy skips tests that degrade the database connection unless
+// the environment runs with WithToxiproxy. Like injectFault, the toxics
+// apply to every client, so these tests must not run in parallel.
+func requireToxiproxy(t *testing.T) {
+	t.Helper()
+	requireIntegration(t)
+	if !localTestContainer.hasService("toxiproxy") {
+		t.Skip("set TEST_TOXIPROXY=1 to put Toxiproxy between the app and Postgres")
+	}
+	t.Cleanup(func() {
+		if err := localTestContainer.ResetDBToxics(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestDBLatency(t *testing.T) {
+	requireToxiproxy(t)
+	item := factory.Item(t)
+
+	if err := localTestContainer.DBLatency(300*time.Millisecond, 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	client.GetItem(t, item.ID)
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+}
+
+func TestDBResetPeer(t *testing.T) {
+	requireToxiproxy(t)
+	item := factory.Item(t)
+
+	if err := localTestContainer.DBResetPeer(0); err != nil {
+		t.Fatal(err)
+	}
+	status, _ := client.Do(t, http.MethodGet, fmt.Sprintf("/items/%d", item.ID), nil)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	// The app recovers once the database does.
+	if err := localTestContainer.ResetDBToxics(); err != nil {
+		t.Fatal(err)
+	}
+	retryFlaky(t, 3, func(t testing.TB) {
+		client.GetItem(t, item.ID)
+	})
+}
+
+func TestToxiproxyAPI(t *testing.T) {
+	var got Toxic
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/proxies/postgres/toxics" {
+			http.Error(w, "proxy not found", http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	api := toxiproxyAPI{url: server.URL}
+	toxic := Toxic{Name: "latency", Type: "latency", Stream: "downstream", Toxicity: 1, Attributes: map[string]any{"latency": float64(100)}}
+	assert.NoError(t, api.do(context.Background(), http.MethodPost, "/proxies/postgres/toxics", toxic))
+	assert.Equal(t, toxic, got)
+
+	err := api.do(context.Background(), http.MethodDelete, "/proxies/mysql/toxics/latency", nil)
+	assert.ErrorContains(t, err, "404 Not Found: proxy not found")
+}
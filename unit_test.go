@@ -0,0 +1,19 @@
+//go:build !integration
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain serves the API from the in-memory store instead of the container
+// environment, so a plain `go test ./...` runs without Docker. Build with
+// -tags integration to run the suite against the containers.
+func TestMain(m *testing.M) {
+	os.Exit(runUnit(m))
+}
+
+func harnessDatabase() (*TestDatabase, error) {
+	return nil, errNoTestDatabase
+}
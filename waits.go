@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// WaitStrategy tells when a container is ready. Ready is retried with
+// backoff until it returns nil or the health phase times out.
+type WaitStrategy interface {
+	Ready(ctx context.Context, target WaitTarget) error
+}
+
+// WaitTarget is the container a WaitStrategy waits for.
+type WaitTarget struct {
+	Pool     *dockertest.Pool
+	Resource *dockertest.Resource
+	// Host is the address the container's published ports are reachable at.
+	Host string
+}
+
+// addr returns the host:port port is published at.
+func (t WaitTarget) addr(port string) (string, error) {
+	published := t.Resource.GetPort(portSpec(port))
+	if published == "" {
+		return "", fmt.Errorf("port %s isn't published", port)
+	}
+	return net.JoinHostPort(t.Host, published), nil
+}
+
+// WaitFunc adapts a function to a WaitStrategy.
+type WaitFunc func(ctx context.Context, target WaitTarget) error
+
+func (f WaitFunc) Ready(ctx context.Context, target WaitTarget) error {
+	return f(ctx, target)
+}
+
+// WithWaitStrategy replaces how the environment waits for the "db", "app"
+// or a sidecar container to be ready. A container is ready once every
+// strategy is.
+func WithWaitStrategy(container string, strategies ...WaitStrategy) Option {
+	return func(o *options) {
+		o.container(container).wait = strategies
+	}
+}
+
+// waitFor retries strategies until all are ready. strategies defaults to
+// fallback when empty.
+func waitFor(ctx context.Context, target WaitTarget, strategies []WaitStrategy, fallback ...WaitStrategy) error {
+	if len(strategies) == 0 {
+		strategies = fallback
+	}
+	return retry(ctx, func() error {
+		for _, s := range strategies {
+			if err := s.Ready(ctx, target); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WaitForPort waits until a published port accepts TCP connections.
+func WaitForPort(port string) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		addr, err := target.addr(port)
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// WaitForHTTP waits until a GET of path on a published port answers with a
+// 2xx status.
+func WaitForHTTP(port string, path string) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		addr, err := target.addr(port)
+		if err != nil {
+			return err
+		}
+		url := "http://" + addr + path
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// WaitForLogLine waits until the container's logs match the regular
+// expression pattern.
+func WaitForLogLine(pattern string) WaitStrategy {
+	re, err := regexp.Compile(pattern)
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		if err != nil {
+			return err
+		}
+		var logs bytes.Buffer
+		err := target.Pool.Client.Logs(docker.LogsOptions{
+			Context:      ctx,
+			Container:    target.Resource.Container.ID,
+			OutputStream: &logs,
+			ErrorStream:  &logs,
+			Stdout:       true,
+			Stderr:       true,
+		})
+		if err != nil {
+			return err
+		}
+		if !re.Match(logs.Bytes()) {
+			return errors.New("no log line matches " + pattern)
+		}
+		return nil
+	})
+}
+
+// WaitForExec waits until cmd, run in the container, exits 0.
+func WaitForExec(cmd ...string) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		return execOK(target.Resource, cmd...)
+	})
+}
+
+// waitForExecOutput waits until cmd, run in the container, prints want.
+func waitForExecOutput(want string, cmd ...string) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		var out bytes.Buffer
+		if _, err := target.Resource.Exec(cmd, dockertest.ExecOptions{StdOut: &out}); err != nil {
+			return err
+		}
+		if got := strings.TrimSpace(out.String()); got != want {
+			return fmt.Errorf("%s printed %q, want %q", strings.Join(cmd, " "), got, want)
+		}
+		return nil
+	})
+}
+
+// waitForDB waits until the database at dsn accepts connections from the
+// tests, which is where the TLS certificate is verified.
+func waitForDB(dsn DSN) WaitStrategy {
+	return WaitFunc(func(ctx context.Context, target WaitTarget) error {
+		db, err := sql.Open(dbDriver, dsn.String())
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return db.PingContext(ctx)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// publishedAt fakes a container publishing port at the address of a local
+// server.
+func publishedAt(t *testing.T, port string, addr string) WaitTarget {
+	host, hostPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WaitTarget{Host: host, Resource: &dockertest.Resource{Container: &docker.Container{
+		NetworkSettings: &docker.NetworkSettings{Ports: map[docker.Port][]docker.PortBinding{
+			docker.Port(portSpec(port)): {{HostIP: "0.0.0.0", HostPort: hostPort}},
+		}},
+	}}}
+}
+
+func TestWaitStrategies(t *testing.T) {
+	healthy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	target := publishedAt(t, "8000", server.Listener.Addr().String())
+	ctx := context.Background()
+
+	assert.NoError(t, WaitForPort("8000").Ready(ctx, target))
+	assert.ErrorContains(t, WaitForPort("9000").Ready(ctx, target), "port 9000 isn't published")
+	assert.ErrorContains(t, WaitForHTTP("8000", "/health").Ready(ctx, target), "answered 503")
+	healthy = true
+	assert.NoError(t, WaitForHTTP("8000", "/health").Ready(ctx, target))
+	assert.Error(t, WaitForLogLine("(").Ready(ctx, target))
+}
+
+func TestWaitFor(t *testing.T) {
+	ready := WaitFunc(func(ctx context.Context, target WaitTarget) error { return nil })
+	never := WaitFunc(func(ctx context.Context, target WaitTarget) error { return errors.New("never ready") })
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// Configured strategies replace the defaults.
+	assert.NoError(t, waitFor(ctx, WaitTarget{}, []WaitStrategy{ready}, never))
+	assert.ErrorContains(t, waitFor(ctx, WaitTarget{}, nil, ready, never), "never ready")
+
+	o := defaultOptions()
+	WithWaitStrategy("app", WaitForHTTP("8000", "/readyz"))(o)
+	assert.Len(t, o.container("app").wait, 1)
+	assert.Empty(t, o.container("db").wait)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+// maxWebhookBackoff caps the wait between two attempts of a delivery.
+const maxWebhookBackoff = time.Hour
+
+// Webhook is an endpoint every item event is POSTed to as JSON.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is a delivery that failed every attempt, see
+// webhookDeliverer.
+type WebhookDelivery struct {
+	ID        int             `json:"id"`
+	WebhookID int             `json:"webhook_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// webhookQueue queues a delivery of every item event for each webhook, due
+// right away on the app's clock. Like the Kafka events, they are queued
+// once the item's write committed, outside its transaction: an event is
+// lost if the app stops between the two, or the queueing fails.
+type webhookQueue struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func (q webhookQueue) Publish(ctx context.Context, event itemEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = q.db.ExecContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, payload, next_attempt_at) SELECT id, $1::jsonb, $2::timestamptz FROM webhooks", payload, q.now())
+	return err
+}
+
+// webhookDeliverer POSTs the queued deliveries. A delivery failing is
+// retried after backoff, doubling with every attempt up to
+// maxWebhookBackoff. After maxAttempts it moves to the dead letters, where
+// it stays until it is replayed.
+type webhookDeliverer struct {
+	db          *sql.DB
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	now         func() time.Time
+}
+
+// enableWebhooks queues a delivery of every item event for the webhooks and
+// returns what delivers them, or nil without a database. Like
+// enableFaultInjection it must be called before registerRoutes.
+func (g *GoPOS) enableWebhooks() (*webhookDeliverer, error) {
+	if g.db == nil {
+		return nil, nil
+	}
+	viper.SetDefault("GOPOS_WEBHOOK_MAX_ATTEMPTS", 8)
+	viper.SetDefault("GOPOS_WEBHOOK_BACKOFF", "1s")
+	viper.SetDefault("GOPOS_WEBHOOK_TIMEOUT", "10s")
+	d := &webhookDeliverer{
+		db:          g.db,
+		client:      &http.Client{Timeout: viper.GetDuration("GOPOS_WEBHOOK_TIMEOUT")},
+		maxAttempts: viper.GetInt("GOPOS_WEBHOOK_MAX_ATTEMPTS"),
+		backoff:     viper.GetDuration("GOPOS_WEBHOOK_BACKOFF"),
+		now:         g.now,
+	}
+	if d.maxAttempts < 1 {
+		return nil, fmt.Errorf("invalid GOPOS_WEBHOOK_MAX_ATTEMPTS: %d", d.maxAttempts)
+	}
+	if d.backoff <= 0 {
+		return nil, fmt.Errorf("invalid GOPOS_WEBHOOK_BACKOFF: %s", d.backoff)
+	}
+	g.store = eventStore{g.store, webhookQueue{g.db, g.now}}
+	return d, nil
+}
+
+// retryAfter is how long to wait after the given number of failed attempts.
+func (d *webhookDeliverer) retryAfter(attempts int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempts && wait < maxWebhookBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxWebhookBackoff)
+}
+
+// deliverWebhooks sends the due deliveries every interval until ctx is done.
+// An interval of zero or less leaves them queued.
+func deliverWebhooks(ctx context.Context, d *webhookDeliverer, interval time.Duration) {
+	if interval <= 0 {
+		log.Println("Webhook delivery disabled, events stay queued")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.deliverDue(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Could not deliver webhooks: %s", err)
+			}
+		}
+	}
+}
+
+// deliverDue attempts every delivery that is due and reports how many it
+// attempted.
+func (d *webhookDeliverer) deliverDue(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		attempted, err := d.deliverNext(ctx)
+		if err != nil || !attempted {
+			return n, err
+		}
+		n++
+	}
+}
+
+// deliverNext attempts the delivery due the longest, if any. It is claimed
+// in a transaction of its own first, counting the attempt and pushing its
+// next attempt past the HTTP timeout, so other instances of the app skip it
+// without a row lock or a connection held while the endpoint answers. An
+// instance crashing mid-attempt leaves it to be retried once the claim
+// runs out.
+func (d *webhookDeliverer) deliverNext(ctx context.Context) (bool, error) {
+	now := d.now()
+	id, attempts, url, payload, err := d.claimNext(ctx, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	postErr := d.post(ctx, url, payload)
+	switch {
+	case postErr == nil:
+		_, err = d.db.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE id = $1", id)
+	case attempts >= d.maxAttempts:
+		log.Printf("Webhook delivery %d failed %d times, giving up: %s", id, attempts, postErr)
+		_, err = d.db.ExecContext(ctx, `WITH failed AS (DELETE FROM webhook_deliveries WHERE id = $1 RETURNING id, webhook_id, payload, created_at)
+			INSERT INTO webhook_dead_letters (id, webhook_id, payload, attempts, last_error, created_at, failed_at)
+			SELECT id, webhook_id, payload, $2::int, $3::text, created_at, $4::timestamptz FROM failed`, id, attempts, postErr.Error(), now)
+	default:
+		_, err = d.db.ExecContext(ctx, "UPDATE webhook_deliveries SET last_error = $1, next_attempt_at = $2 WHERE id = $3",
+			postErr.Error(), now.Add(d.retryAfter(attempts)), id)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// claimNext claims the delivery due the longest at now, returning
+// sql.ErrNoRows when none is, and reports its attempt number.
+func (d *webhookDeliverer) claimNext(ctx context.Context, now time.Time) (id int, attempts int, url string, payload []byte, err error) {
+	claim := d.client.Timeout
+	if claim <= 0 {
+		claim = maxWebhookBackoff
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `SELECT d.id, d.attempts, w.url, d.payload FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.next_attempt_at <= $1 ORDER BY d.next_attempt_at LIMIT 1 FOR UPDATE OF d SKIP LOCKED`, now).Scan(&id, &attempts, &url, &payload)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	attempts++
+	_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET attempts = $1, next_attempt_at = $2 WHERE id = $3", attempts, now.Add(claim), id)
+	if err != nil {
+		return 0, 0, "", nil, err
+	}
+	return id, attempts, url, payload, tx.Commit()
+}
+
+// post sends payload to url, failing unless it is answered with a 2xx.
+func (d *webhookDeliverer) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+func createWebhook(ctx context.Context, db *sql.DB, url string) (Webhook, error) {
+	hook := Webhook{URL: url}
+	err := db.QueryRowContext(ctx, "INSERT INTO webhooks (url) VALUES ($1) RETURNING id, created_at", url).Scan(&hook.ID, &hook.CreatedAt)
+	return hook, err
+}
+
+func listWebhooks(ctx context.Context, db *sql.DB) ([]Webhook, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, url, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// deleteWebhook deletes the webhook with its pending and failed deliveries.
+func deleteWebhook(ctx context.Context, db *sql.DB, id int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+func webhookExists(ctx context.Context, db *sql.DB, id int) error {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errWebhookNotFound
+	}
+	return nil
+}
+
+// failedDeliveries lists the dead letters of the webhook, oldest first.
+func failedDeliveries(ctx context.Context, db *sql.DB, webhookID int) ([]WebhookDelivery, error) {
+	if err := webhookExists(ctx, db, webhookID); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, webhook_id, payload, attempts, last_error, created_at, failed_at
+		FROM webhook_dead_letters WHERE webhook_id = $1 ORDER BY id`, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		// Scanned as []byte, which database/sql copies; a RawMessage would
+		// share the driver's buffer.
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.WebhookID, &payload, &d.Attempts, &d.LastError, &d.CreatedAt, &d.FailedAt); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// replayDeliveries queues the dead letters of the webhook with the given
+// ids, or all of them without ids, for delivery at now with a fresh set of
+// attempts. It returns how many were queued.
+func replayDeliveries(ctx context.Context, db *sql.DB, webhookID int, ids []int, now time.Time) (int64, error) {
+	if err := webhookExists(ctx, db, webhookID); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		// NULL, for all of them.
+		ids = nil
+	}
+	result, err := db.ExecContext(ctx, `WITH replayed AS (
+			DELETE FROM webhook_dead_letters WHERE webhook_id = $1 AND ($2::int[] IS NULL OR id = ANY($2))
+			RETURNING id, webhook_id, payload, created_at)
+		INSERT INTO webhook_deliveries (id, webhook_id, payload, next_attempt_at, created_at)
+		SELECT id, webhook_id, payload, $3::timestamptz, created_at FROM replayed`, webhookID, ids, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type webhookRequest struct {
+	URL string `json:"url" binding:"required,http_url"`
+}
+
+type replayRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// webhookID reads the :id of a webhook route.
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return 0, false
+	}
+	return int(id), true
+}
+
+// requireWebhookDB answers requests when the app runs without a database,
+// which keeps the webhooks.
+func (g *GoPOS) requireWebhookDB(c *gin.Context) {
+	if g.db == nil {
+		c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": "Webhooks need a database"})
+		return
+	}
+	c.Next()
+}
+
+func webhookError(c *gin.Context, err error) {
+	if errors.Is(err, errWebhookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// registerWebhooks mounts the endpoints registering webhooks and inspecting
+// and replaying their failed deliveries.
+func (g *GoPOS) registerWebhooks(router gin.IRouter) {
+	hooks := router.Group("/webhooks", g.requireWebhookDB)
+	hooks.GET("", g.getWebhooks)
+	hooks.HEAD("", g.getWebhooks)
+	hooks.POST("", g.createWebhook)
+	hooks.DELETE("/:id", g.deleteWebhook)
+	hooks.GET("/:id/deliveries", g.getFailedDeliveries)
+	hooks.HEAD("/:id/deliveries", g.getFailedDeliveries)
+	hooks.POST("/:id/deliveries", g.replayDeliveries)
+}
+
+func (g *GoPOS) getWebhooks(c *gin.Context) {
+	hooks, err := listWebhooks(c.Request.Context(), g.db)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+func (g *GoPOS) createWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hook, err := createWebhook(c.Request.Context(), g.db, req.URL)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, hook)
+}
+
+func (g *GoPOS) deleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	if err := deleteWebhook(c.Request.Context(), g.db, id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (g *GoPOS) getFailedDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveries, err := failedDeliveries(c.Request.Context(), g.db, id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// replayDeliveries queues failed deliveries again, those listed in ids or
+// all of them for an empty body.
+func (g *GoPOS) replayDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req replayRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	n, err := replayDeliveries(c.Request.Context(), g.db, id, req.IDs, g.now())
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"replayed": n})
+}
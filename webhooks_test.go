@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetryAfter(t *testing.T) {
+	d := &webhookDeliverer{backoff: time.Second}
+	assert.Equal(t, time.Second, d.retryAfter(1))
+	assert.Equal(t, 2*time.Second, d.retryAfter(2))
+	assert.Equal(t, 4*time.Second, d.retryAfter(3))
+	assert.Equal(t, maxWebhookBackoff, d.retryAfter(20))
+	assert.Equal(t, maxWebhookBackoff, d.retryAfter(1000))
+}
+
+func TestWebhooksNeedDB(t *testing.T) {
+	w := httptest.NewRecorder()
+	newMemRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+// webhookReceiver records the events POSTed to it, answering 503 until it
+// is told to accept them.
+type webhookReceiver struct {
+	accept atomic.Bool
+	mu     sync.Mutex
+	events []itemEvent
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.accept.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var event itemEvent
+	if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+
+	db, _ := requireIsolatedDB(t)
+	clock := &offsetClock{}
+	g := &GoPOS{db: db, store: newSQLItemStore(db), clock: clock}
+	deliverer, err := g.enableWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverer.maxAttempts = 2
+	router := gin.New()
+	handleMethods(router)
+	g.registerRoutes(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	api := newAPIClient(srv.URL)
+	receiver := &webhookReceiver{}
+	receiverSrv := httptest.NewServer(receiver)
+	defer receiverSrv.Close()
+
+	var hook Webhook
+	api.Request(t, http.MethodPost, "/webhooks", webhookRequest{URL: receiverSrv.URL}, http.StatusCreated, &hook)
+	api.Request(t, http.MethodPost, "/webhooks", webhookRequest{URL: "not a url"}, http.StatusBadRequest, nil)
+	item := api.CreateItem(t, Item{Name: "TestWebhookDeliveries", Price: 1, Stock: 1})
+	ctx := context.Background()
+	deliver := func() int {
+		t.Helper()
+		n, err := deliverer.deliverDue(ctx)
+		if err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+		return n
+	}
+
+	// The first attempt fails, the second one is due after the backoff and
+	// moves the delivery to the dead letters.
+	assert.Equal(t, 1, deliver())
+	assert.Equal(t, 0, deliver())
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, deliver())
+	clock.Advance(time.Hour)
+	assert.Equal(t, 0, deliver())
+
+	path := fmt.Sprintf("/webhooks/%d/deliveries", hook.ID)
+	var failed []WebhookDelivery
+	api.Request(t, http.MethodGet, path, nil, http.StatusOK, &failed)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, 2, failed[0].Attempts)
+		assert.Contains(t, failed[0].LastError, "503")
+		var event itemEvent
+		assert.NoError(t, json.Unmarshal(failed[0].Payload, &event))
+		assert.Equal(t, itemEvent{Type: "created", Item: item}, event)
+	}
+
+	// Replayed, it is delivered once the receiver is back.
+	receiver.accept.Store(true)
+	var replayed map[string]int
+	api.Request(t, http.MethodPost, path, nil, http.StatusAccepted, &replayed)
+	assert.Equal(t, 1, replayed["replayed"])
+	assert.Equal(t, 1, deliver())
+	assert.Equal(t, []itemEvent{{Type: "created", Item: item}}, receiver.events)
+	api.Request(t, http.MethodGet, path, nil, http.StatusOK, &failed)
+	assert.Empty(t, failed)
+
+	api.Request(t, http.MethodDelete, fmt.Sprintf("/webhooks/%d", hook.ID), nil, http.StatusNoContent, nil)
+	api.Request(t, http.MethodGet, path, nil, http.StatusNotFound, nil)
+	api.Request(t, http.MethodPost, path, nil, http.StatusNotFound, nil)
+}
+
+// TestWebhookDeliveryHoldsNoLock checks that a delivery is claimed rather
+// than locked while its endpoint answers, so other instances skip it and
+// nothing waits on the slow endpoint.
+func TestWebhookDeliveryHoldsNoLock(t *testing.T) {
+	t.Parallel()
+
+	db, _ := requireIsolatedDB(t)
+	g := &GoPOS{db: db, store: newSQLItemStore(db), clock: &offsetClock{}}
+	deliverer, err := g.enableWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan struct{})
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	hook, err := createWebhook(ctx, db, receiver.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.store.CreateItem(ctx, Item{Name: "TestWebhookDeliveryHoldsNoLock", Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := deliverer.deliverNext(ctx)
+		done <- err
+	}()
+	<-received
+
+	var attempts int
+	err = db.QueryRow("SELECT attempts FROM webhook_deliveries WHERE webhook_id = $1 FOR UPDATE NOWAIT", hook.ID).Scan(&attempts)
+	assert.NoError(t, err, "the delivery's row is locked during the attempt")
+	assert.Equal(t, 1, attempts)
+	attempted, err := deliverer.deliverNext(ctx)
+	assert.NoError(t, err)
+	assert.False(t, attempted, "a claimed delivery was attempted twice")
+
+	close(release)
+	assert.NoError(t, <-done)
+	var n int
+	assert.NoError(t, db.QueryRow("SELECT count(*) FROM webhook_deliveries WHERE webhook_id = $1", hook.ID).Scan(&n))
+	assert.Zero(t, n)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// stockAdjustment is the event the warehouse system publishes when the
+// stock of an item changes. Delta is added to the item's stock.
+type stockAdjustment struct {
+	EventID string `json:"event_id"`
+	ItemID  int    `json:"item_id"`
+	Delta   int    `json:"delta"`
+}
+
+func newWorkerCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "worker",
+		Short:        "Apply stock adjustments from the warehouse Kafka topic.",
+		SilenceUsage: true,
+		RunE:         worker,
+	}
+}
+
+func worker(cmd *cobra.Command, args []string) error {
+	viper.SetDefault("GOPOS_KAFKA_BROKERS", "localhost:9092")
+	viper.SetDefault("GOPOS_STOCK_TOPIC", "stock-adjustments")
+	viper.SetDefault("GOPOS_KAFKA_GROUP", "gopos")
+
+	if err := postgresOnly("the worker"); err != nil {
+		return err
+	}
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store := newSQLItemStore(db)
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: strings.Split(viper.GetString("GOPOS_KAFKA_BROKERS"), ","),
+		Topic:   viper.GetString("GOPOS_STOCK_TOPIC"),
+		GroupID: viper.GetString("GOPOS_KAFKA_GROUP"),
+	})
+	defer reader.Close()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Consuming stock adjustments from %s", reader.Config().Topic)
+	return consumeStockAdjustments(ctx, reader, store)
+}
+
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// consumeStockAdjustments applies messages until ctx is done. Offsets are
+// committed after a message is applied, so a crash redelivers it; the event
+// id makes applying it again a no-op.
+func consumeStockAdjustments(ctx context.Context, reader messageReader, store *sqlItemStore) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := applyStockMessage(ctx, store, msg.Value); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("offset %d: %w", msg.Offset, err)
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// applyStockMessage applies one event. Events that can never be applied are
+// logged and skipped so they don't block the partition; only database
+// errors are returned.
+func applyStockMessage(ctx context.Context, store *sqlItemStore, value []byte) error {
+	var adj stockAdjustment
+	if err := json.Unmarshal(value, &adj); err != nil || adj.EventID == "" {
+		log.Printf("Skipping malformed stock adjustment: %s", value)
+		return nil
+	}
+
+	applied, err := store.ApplyStockAdjustment(ctx, adj)
+	switch {
+	case errors.Is(err, errItemNotFound):
+		log.Printf("Skipping stock adjustment %s for unknown item %d", adj.EventID, adj.ItemID)
+		return nil
+	case err != nil:
+		return err
+	case !applied:
+		log.Printf("Stock adjustment %s was already applied", adj.EventID)
+	}
+	return nil
+}
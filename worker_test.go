@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReader serves messages, then blocks until the context is done.
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.messages) == 0 {
+		r.mu.Unlock()
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := r.messages[0]
+	r.messages = r.messages[1:]
+	r.mu.Unlock()
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func stockMessage(t *testing.T, offset int64, adj stockAdjustment) kafka.Message {
+	value, err := json.Marshal(adj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Offset: offset, Value: value}
+}
+
+func TestConsumeStockAdjustments(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLItemStore(requireTestDB(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	item, err := store.CreateItem(ctx, Item{Name: "TestConsumeStockAdjustments", Price: 1, Stock: 1})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(context.Background(), item.ID)
+	})
+
+	prefix := fmt.Sprintf("%d-", rand.Int63())
+	reader := &fakeReader{messages: []kafka.Message{
+		stockMessage(t, 1, stockAdjustment{EventID: prefix + "1", ItemID: item.ID, Delta: 5}),
+		// Redelivered.
+		stockMessage(t, 2, stockAdjustment{EventID: prefix + "1", ItemID: item.ID, Delta: 5}),
+		stockMessage(t, 3, stockAdjustment{EventID: prefix + "2", ItemID: 0, Delta: 5}),
+		{Offset: 4, Value: []byte("not json")},
+		stockMessage(t, 5, stockAdjustment{EventID: prefix + "3", ItemID: item.ID, Delta: -2}),
+	}}
+
+	done := make(chan error)
+	go func() {
+		done <- consumeStockAdjustments(ctx, reader, store)
+	}()
+	// 1 + 5 - 2: the redelivered event counts once.
+	assert.Eventually(t, func() bool {
+		fetched, err := store.GetItem(ctx, item.ID)
+		return err == nil && fetched.Stock == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return reader.pending() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, reader.committed)
+}
+
+func TestApplyStockAdjustmentNeverGoesNegative(t *testing.T) {
+	t.Parallel()
+
+	store := newSQLItemStore(requireTestDB(t))
+	ctx := context.Background()
+	item, err := store.CreateItem(ctx, Item{Name: "TestApplyStockAdjustmentNeverGoesNegative", Price: 1, Stock: 3})
+	if err != nil {
+		t.Fatalf("Failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteItem(ctx, item.ID)
+	})
+
+	applied, err := store.ApplyStockAdjustment(ctx, stockAdjustment{EventID: fmt.Sprintf("%d", rand.Int63()), ItemID: item.ID, Delta: -10})
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	fetched, err := store.GetItem(ctx, item.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, fetched.Stock)
+}
+
+func TestApplyStockMessageSkipsMalformed(t *testing.T) {
+	// Malformed events never reach the store.
+	assert.NoError(t, applyStockMessage(context.Background(), nil, []byte("not json")))
+	assert.NoError(t, applyStockMessage(context.Background(), nil, []byte(`{"item_id":1,"delta":1}`)))
+}